@@ -0,0 +1,431 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// A Command is a node in a tree of subcommands, e.g., "tool serve" or "tool
+// db migrate". Each command owns a FlagSet. When a command is executed, its
+// flags are parsed, and if the first remaining argument names a child
+// command (or one of its aliases), the child is executed with the rest of
+// the arguments. Otherwise, the command's `Run` function is called with the
+// remaining arguments.
+//
+// Flags defined in a command's `PersistentFlags()` are also accepted by all
+// of its descendants, e.g., "tool -v serve" and "tool serve -v" are
+// equivalent if `-v` is a persistent flag of "tool". One-character aliases
+// of persistent flags (see `FlagSet.FlagShort()`) are inherited too, unless
+// the descendant uses the same alias for a flag of its own. A persistent
+// flag marked as required (see `FlagSet.MarkRequired()`) may be given before
+// or after the name of a descendant; it is checked by the command that runs.
+// The same goes for groups of persistent flags (see
+// `FlagSet.MutuallyExclusive()` and `FlagSet.AtLeastOne()`).
+//
+// A command uses the syntax (see `FlagSet.SetSyntax()`) and interspersed
+// setting (see `FlagSet.SetInterspersed()`) of its parent, unless they have
+// been set on its own `Flags()`. Flags and non-flag arguments can't be
+// interspersed for a command with children, since the first non-flag
+// argument selects the child.
+//
+// Commands that have children automatically support a "help" command, e.g.,
+// "tool help serve" prints the usage message for "tool serve".
+type Command struct {
+    Name string        // Name used to invoke the command.
+    Aliases []string   // Alternative names for the command.
+    Summary string     // One-line description, shown in command lists.
+    Description string // Longer description, shown in the usage message.
+
+    // Called with the command and the remaining (non-flag) arguments after
+    // parsing. If nil, the command must be given a subcommand.
+    Run func(cmd *Command, args []string) error
+
+    flags *FlagSet
+    persistent *FlagSet
+    parent *Command
+    children []*Command
+    output io.Writer
+}
+
+// Returns a new command with the specified name, summary, and run function.
+func NewCommand(
+    name, summary string,
+    run func(cmd *Command, args []string) error,
+) *Command {
+    cmd := &Command{Name: name, Summary: summary, Run: run}
+    cmd.flags = NewFlagSet(name, ContinueOnError)
+    cmd.flags.Usage = cmd.PrintHelp
+
+    return cmd
+}
+
+// Returns the flags for this command.
+func (c *Command) Flags() *FlagSet {
+    return c.flags
+}
+
+// Returns the flags for this command that are also accepted by all of its
+// descendants.
+func (c *Command) PersistentFlags() *FlagSet {
+    if c.persistent == nil {
+        c.persistent = NewFlagSet(c.Name, ContinueOnError)
+    }
+
+    return c.persistent
+}
+
+// Adds child commands.
+func (c *Command) AddCommand(children ...*Command) {
+    for _, child := range children {
+        child.parent = c
+        c.children = append(c.children, child)
+    }
+}
+
+// Returns the child commands, in the order they were added.
+func (c *Command) Commands() []*Command {
+    return c.children
+}
+
+// Returns the parent command, or nil for the root command.
+func (c *Command) Parent() *Command {
+    return c.parent
+}
+
+// Returns the child command with the specified name or alias, or nil.
+func (c *Command) Lookup(name string) *Command {
+    for _, child := range c.children {
+        if child.Name == name {
+            return child
+        }
+        for _, alias := range child.Aliases {
+            if alias == name {
+                return child
+            }
+        }
+    }
+
+    return nil
+}
+
+// Returns the full name of the command, e.g., "tool db migrate".
+func (c *Command) Path() string {
+    if c.parent == nil {
+        return c.Name
+    }
+
+    return c.parent.Path() + " " + c.Name
+}
+
+// Sets the destination for usage and error messages for this command and
+// its descendants. If output is nil, the parent's output (or os.Stderr for
+// the root command) is used.
+func (c *Command) SetOutput(w io.Writer) {
+    c.output = w
+}
+
+// Returns the destination for usage and error messages.
+func (c *Command) Output() io.Writer {
+    if c.output != nil {
+        return c.output
+    }
+    if c.parent != nil {
+        return c.parent.Output()
+    }
+
+    return os.Stderr
+}
+
+// Prints the usage message for the command: a synopsis, the description,
+// the child commands, and the flags.
+func (c *Command) PrintHelp() {
+    c.prepare()
+    w := c.Output()
+
+    synopsis := c.Path() + " [flags]"
+    if len(c.children) > 0 {
+        synopsis += " <command>"
+    }
+    if args := c.flags.positional_synopsis(); args != "" {
+        synopsis += " " + args
+    } else {
+        synopsis += " [args]"
+    }
+    fmt.Fprintf(w, "Usage: %s\n", synopsis)
+
+    if c.Description != "" {
+        fmt.Fprintf(w, "\n%s\n", c.Description)
+    } else if c.Summary != "" {
+        fmt.Fprintf(w, "\n%s\n", c.Summary)
+    }
+
+    if len(c.children) > 0 {
+        fmt.Fprintf(w, "\nCommands:\n")
+        names := make([]string, len(c.children))
+        width := 0
+        for i, child := range c.children {
+            names[i] = strings.Join(append([]string{child.Name},
+                child.Aliases...), ", ")
+            if len(names[i]) > width {
+                width = len(names[i])
+            }
+        }
+        for i, child := range c.children {
+            fmt.Fprintf(w, "  %-*s  %s\n", width, names[i], child.Summary)
+        }
+        fmt.Fprintf(w, "\nUse \"%s help <command>\" for more information " +
+            "about a command.\n", c.Path())
+    }
+
+    has_flags := false
+    c.flags.VisitAll(func(*flag.Flag) { has_flags = true })
+    if has_flags {
+        fmt.Fprintf(w, "\nFlags:\n")
+        c.flags.PrintDefaults()
+    }
+}
+
+// Parses `args` (which should not include the program name) and runs the
+// selected command. Errors are returned rather than causing an exit, so that
+// the caller can decide how to report them. Use `ExitCode()` to map the
+// error to an exit status, or call `Main()` instead.
+//
+// If -h or -help is given, or the "help" command is used, the usage message
+// is printed and ErrHelp is returned. Flag errors are returned as a
+// `*ParseError`, and an unknown command (or a missing one, for commands
+// without a `Run` function) as a `*CommandError`. Errors returned by a `Run`
+// function are returned as-is.
+func (c *Command) Execute(args []string) error {
+    c.prepare()
+    c.flags.inherited = c.inherited_flags()
+    if err := c.flags.Parse(args); err != nil {
+        return err
+    }
+
+    rest := c.flags.Args()
+    if len(c.children) > 0 && len(rest) > 0 {
+        if rest[0] == "help" && c.Lookup("help") == nil {
+            return c.help(rest[1:])
+        }
+        if child := c.Lookup(rest[0]); child != nil {
+            return child.Execute(rest[1:])
+        }
+        if c.Run == nil {
+            return c.command_error(rest[0])
+        }
+    }
+
+    if c.Run == nil {
+        return c.command_error("")
+    }
+
+    return c.Run(c, rest)
+}
+
+// Executes the command with the program's command-line arguments. On
+// error, the error is printed (unless it has already been reported), and the
+// program exits with the status given by `ExitCode()`.
+func (c *Command) Main() {
+    err := c.Execute(os.Args[1:])
+    if err != nil && !errors.Is(err, ErrHelp) {
+        var parse_err *ParseError
+        var cmd_err *CommandError
+        if !errors.As(err, &parse_err) && !errors.As(err, &cmd_err) {
+            fmt.Fprintf(c.Output(), "%s: %s\n", c.Name, err)
+        }
+    }
+
+    os.Exit(ExitCode(err))
+}
+
+// Implements the "help" command: prints the usage message for the command
+// named by `args`, relative to `c`.
+func (c *Command) help(args []string) error {
+    target := c
+    for _, name := range args {
+        child := target.Lookup(name)
+        if child == nil {
+            return target.command_error(name)
+        }
+        target = child
+    }
+    target.PrintHelp()
+
+    return ErrHelp
+}
+
+// Reports an unknown or missing subcommand, followed by the usage message.
+func (c *Command) command_error(name string) error {
+    err := &CommandError{Command: c.Path(), Name: name}
+    fmt.Fprintln(c.Output(), err)
+    c.PrintHelp()
+
+    return err
+}
+
+// Makes the persistent flags of the command and its ancestors available in
+// the command's own FlagSet. The flag.Value objects are shared, so setting a
+// persistent flag from any command sets the same variable.
+func (c *Command) prepare() {
+    c.flags.SetOutput(c.Output())
+    c.flags.syntax = c.flag_syntax()
+    c.flags.interspersed = c.flag_interspersed()
+    c.flags.has_commands = len(c.children) > 0
+    c.flags.selects_command = func(args []string) bool {
+        return len(c.children) > 0 && len(args) > 0 &&
+            (args[0] == "help" || c.Lookup(args[0]) != nil)
+    }
+    if c.flags.persistent == nil {
+        c.flags.persistent = make(map[string]bool)
+    }
+
+    for cmd := c; cmd != nil; cmd = cmd.parent {
+        if cmd.persistent == nil {
+            continue
+        }
+        cmd.persistent.VisitAll(func(f *flag.Flag) {
+            if c.flags.flag_flagset.Lookup(f.Name) != nil {
+                return
+            }
+            c.flags.flag_flagset.Var(f.Value, f.Name, f.Usage)
+            c.flags.persistent[f.Name] = true
+            short := cmd.persistent.short_name(f.Name)
+            if _, taken := c.flags.shorts[short]; short != "" && !taken {
+                c.flags.shorts[short] = f.Name
+            }
+            if spec, ok := cmd.persistent.specs[f.Name]; ok {
+                c.flags.specs[f.Name] = spec
+                if spec.set_func != nil {
+                    c.flags.special_flags = append(c.flags.special_flags,
+                        spec)
+                }
+            }
+        })
+        for _, g := range cmd.persistent.groups {
+            c.flags.add_persistent_group(g)
+        }
+    }
+}
+
+// Returns the persistent flags that were set while parsing the arguments
+// for the command's ancestors. These are shared with the command, so they
+// count as set for it, too.
+func (c *Command) inherited_flags() map[string]bool {
+    if c.parent == nil {
+        return nil
+    }
+
+    inherited := make(map[string]bool)
+    for name := range c.parent.flags.set_flags() {
+        f := c.flags.flag_flagset.Lookup(name)
+        parent_f := c.parent.flags.flag_flagset.Lookup(name)
+        if c.flags.persistent[name] && f != nil && parent_f != nil &&
+            f.Value == parent_f.Value {
+            inherited[name] = true
+        }
+    }
+
+    return inherited
+}
+
+// Returns the syntax of the command's flags: its own, if set, or else that
+// of its parent.
+func (c *Command) flag_syntax() Syntax {
+    if c.flags.syntax_set || c.parent == nil {
+        return c.flags.syntax
+    }
+
+    return c.parent.flag_syntax()
+}
+
+// Returns whether flags and non-flag arguments may be interspersed for the
+// command: its own setting, if set, or else that of its parent.
+func (c *Command) flag_interspersed() bool {
+    if c.flags.interspersed_set || c.parent == nil {
+        return c.flags.interspersed
+    }
+
+    return c.parent.flag_interspersed()
+}
+
+// Returned by `Command.Execute()` when a subcommand is unknown, or when one
+// is required but missing.
+type CommandError struct {
+    Command string // Path of the command, e.g., "tool db".
+    Name string    // The unknown subcommand, or "" if it was missing.
+}
+
+func (e *CommandError) Error() string {
+    if e.Name == "" {
+        return fmt.Sprintf("%s: missing command", e.Command)
+    }
+    return fmt.Sprintf("%s: unknown command %q", e.Command, e.Name)
+}
+
+// Returned by a command's `Run` function to exit with a specific status.
+type ExitError struct {
+    Code int  // The exit status.
+    Err error // The underlying error, if any.
+}
+
+func (e *ExitError) Error() string {
+    if e.Err == nil {
+        return fmt.Sprintf("exit status %d", e.Code)
+    }
+    return e.Err.Error()
+}
+
+// Returns the underlying error.
+func (e *ExitError) Unwrap() error {
+    return e.Err
+}
+
+// Maps an error returned by `Command.Execute()` to an exit status: 0 for
+// nil or ErrHelp, the code of an `*ExitError`, 2 for usage errors
+// (`*ParseError` and `*CommandError`), and 1 otherwise.
+func ExitCode(err error) int {
+    var exit_err *ExitError
+    var parse_err *ParseError
+    var cmd_err *CommandError
+
+    switch {
+    case err == nil, errors.Is(err, ErrHelp):
+        return 0
+    case errors.As(err, &exit_err):
+        return exit_err.Code
+    case errors.As(err, &parse_err), errors.As(err, &cmd_err):
+        return 2
+    }
+
+    return 1
+}
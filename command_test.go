@@ -0,0 +1,444 @@
+package flagutil_test
+
+import (
+    "bytes"
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type test_app struct {
+    root *flagutil.Command
+    serve *flagutil.Command
+    verbose bool
+    port int
+    ran string
+    args []string
+    out *bytes.Buffer
+}
+
+func new_test_app() *test_app {
+    app := &test_app{out: new(bytes.Buffer)}
+
+    app.root = flagutil.NewCommand("tool", "A test tool", nil)
+    app.root.SetOutput(app.out)
+    app.root.PersistentFlags().Flag(&app.verbose, "v", "Verbose output")
+
+    app.serve = flagutil.NewCommand("serve", "Run the server",
+        func(cmd *flagutil.Command, args []string) error {
+            app.ran = cmd.Path()
+            app.args = args
+            return nil
+        })
+    app.serve.Aliases = []string{"s"}
+    app.serve.Flags().Flag(&app.port, "port", "Port to listen on")
+
+    fail := flagutil.NewCommand("fail", "Always fails",
+        func(cmd *flagutil.Command, args []string) error {
+            return &flagutil.ExitError{Code: 3, Err: errors.New("failed")}
+        })
+
+    app.root.AddCommand(app.serve, fail)
+
+    return app
+}
+
+func TestCommandDispatch(t *testing.T) {
+    for _, args := range [][]string{
+        {"-v", "serve", "-port", "8080", "a", "b"},
+        {"serve", "-v", "-port", "8080", "a", "b"},
+        {"s", "-port=8080", "-v", "a", "b"},
+    } {
+        app := new_test_app()
+        if err := app.root.Execute(args); err != nil {
+            t.Errorf("%v: unexpected error: %s", args, err)
+            continue
+        }
+        if app.ran != "tool serve" {
+            t.Errorf("%v: ran %q, expected %q", args, app.ran, "tool serve")
+        }
+        if !app.verbose || app.port != 8080 {
+            t.Errorf("%v: got verbose=%t port=%d", args, app.verbose,
+                app.port)
+        }
+        if !reflect.DeepEqual(app.args, []string{"a", "b"}) {
+            t.Errorf("%v: got args %v", args, app.args)
+        }
+    }
+}
+
+func TestCommandInheritance(t *testing.T) {
+    var debug, quiet bool
+    var name string
+    var ran []string
+
+    root := flagutil.NewCommand("tool", "A test tool", nil)
+    root.SetOutput(io.Discard)
+    root.Flags().SetSyntax(flagutil.GNUSyntax)
+    root.Flags().SetInterspersed(true)
+    root.PersistentFlags().FlagShort(&debug, "debug", "Debug output", "d")
+    root.PersistentFlags().FlagShort(&quiet, "quiet", "Quiet output", "q")
+
+    serve := flagutil.NewCommand("serve", "Run the server",
+        func(cmd *flagutil.Command, args []string) error {
+            ran = args
+            return nil
+        })
+    // The child's own use of -q takes precedence over the inherited alias.
+    serve.Flags().FlagShort(&name, "name", "Server name", "q")
+    root.AddCommand(serve)
+
+    err := root.Execute([]string{"serve", "a", "-d", "--quiet", "-qx", "b"})
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if !debug || !quiet || name != "x" {
+        t.Errorf("got debug=%t quiet=%t name=%q", debug, quiet, name)
+    }
+    if !reflect.DeepEqual(ran, []string{"a", "b"}) {
+        t.Errorf("got args %v", ran)
+    }
+
+    // A child's own settings are kept.
+    serve.Flags().SetInterspersed(false)
+    ran = nil
+    if err := root.Execute([]string{"serve", "a", "-d"}); err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if !reflect.DeepEqual(ran, []string{"a", "-d"}) {
+        t.Errorf("got args %v", ran)
+    }
+}
+
+func TestCommandRequiredPersistent(t *testing.T) {
+    new_root := func(token *string) *flagutil.Command {
+        root := flagutil.NewCommand("tool", "A test tool",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            })
+        root.SetOutput(io.Discard)
+        root.PersistentFlags().Flag(token, "token", "API token")
+        root.PersistentFlags().MarkRequired("token")
+        root.AddCommand(flagutil.NewCommand("serve", "Run the server",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            }))
+        return root
+    }
+
+    for _, args := range [][]string{
+        {"-token", "t", "serve"},
+        {"serve", "-token", "t"},
+        {"-token", "t"},
+    } {
+        var token string
+        if err := new_root(&token).Execute(args); err != nil {
+            t.Errorf("%v: unexpected error: %s", args, err)
+        }
+        if token != "t" {
+            t.Errorf("%v: got token %q", args, token)
+        }
+    }
+
+    for _, args := range [][]string{{"serve"}, {}, {"x"}} {
+        var token string
+        err := new_root(&token).Execute(args)
+        var req_err *flagutil.RequiredFlagError
+        if !errors.As(err, &req_err) {
+            t.Errorf("%v: expected a *RequiredFlagError, got %v", args, err)
+        }
+    }
+}
+
+func TestCommandPersistentGroups(t *testing.T) {
+    new_root := func() *flagutil.Command {
+        var file, url, cert, key string
+        root := flagutil.NewCommand("tool", "A test tool",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            })
+        root.SetOutput(io.Discard)
+        flags := root.PersistentFlags()
+        flags.Flag(&file, "file", "Input file")
+        flags.Flag(&url, "url", "Input URL")
+        flags.Flag(&cert, "cert", "Certificate")
+        flags.Flag(&key, "key", "Key")
+        flags.MutuallyExclusive("file", "url")
+        flags.AtLeastOne("file", "url")
+        flags.DependsOn("cert", "key")
+        root.AddCommand(flagutil.NewCommand("serve", "Run the server",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            }))
+        return root
+    }
+
+    for _, args := range [][]string{
+        {"-file", "f", "serve"},
+        {"serve", "-url", "u"},
+        {"-cert", "c", "serve", "-key", "k", "-file", "f"},
+        {"-url", "u"},
+    } {
+        if err := new_root().Execute(args); err != nil {
+            t.Errorf("%v: unexpected error: %s", args, err)
+        }
+    }
+
+    for _, args := range [][]string{
+        {"-file", "f", "serve", "-url", "u"},
+        {"serve", "-file", "f", "-url", "u"},
+        {"serve"},
+        {},
+        {"serve", "-file", "f", "-cert", "c"},
+    } {
+        err := new_root().Execute(args)
+        var group_err *flagutil.FlagGroupError
+        if !errors.As(err, &group_err) {
+            t.Errorf("%v: expected a *FlagGroupError, got %v", args, err)
+        }
+    }
+}
+
+func TestCommandPersistentSliceAppend(t *testing.T) {
+    for _, args := range [][]string{
+        {"-tag", "a", "serve"},
+        {"serve", "-tag", "a"},
+        {"-tag", "a"},
+    } {
+        tags := []string{"d"}
+        root := flagutil.NewCommand("tool", "A test tool",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            })
+        root.SetOutput(io.Discard)
+        root.PersistentFlags().Flag(&tags, "tag", "Tags")
+        root.PersistentFlags().SetSlicePolicy("tag", flagutil.SliceAppend)
+        root.AddCommand(flagutil.NewCommand("serve", "Run the server",
+            func(cmd *flagutil.Command, args []string) error {
+                return nil
+            }))
+
+        if err := root.Execute(args); err != nil {
+            t.Errorf("%v: unexpected error: %s", args, err)
+            continue
+        }
+        if expected := []string{"d", "a"}; !reflect.DeepEqual(tags, expected) {
+            t.Errorf("%v: got %q, expected %q", args, tags, expected)
+        }
+    }
+}
+
+func TestCommandErrors(t *testing.T) {
+    tests := []struct {
+        args []string
+        code int
+        check func(err error) bool
+    }{
+        {[]string{}, 2, func(err error) bool {
+            var cmd_err *flagutil.CommandError
+            return errors.As(err, &cmd_err) && cmd_err.Name == ""
+        }},
+        {[]string{"bogus"}, 2, func(err error) bool {
+            var cmd_err *flagutil.CommandError
+            return errors.As(err, &cmd_err) && cmd_err.Name == "bogus" &&
+                cmd_err.Command == "tool"
+        }},
+        {[]string{"serve", "-bogus"}, 2, func(err error) bool {
+            var parse_err *flagutil.ParseError
+            return errors.As(err, &parse_err)
+        }},
+        {[]string{"fail"}, 3, func(err error) bool {
+            return err.Error() == "failed"
+        }},
+        {[]string{"serve", "-h"}, 0, func(err error) bool {
+            return errors.Is(err, flagutil.ErrHelp)
+        }},
+    }
+
+    for _, test := range tests {
+        app := new_test_app()
+        err := app.root.Execute(test.args)
+        if err == nil {
+            t.Errorf("%v: expected an error", test.args)
+            continue
+        }
+        if !test.check(err) {
+            t.Errorf("%v: unexpected error %T: %s", test.args, err, err)
+        }
+        if code := flagutil.ExitCode(err); code != test.code {
+            t.Errorf("%v: got exit code %d, expected %d", test.args, code,
+                test.code)
+        }
+    }
+
+    if code := flagutil.ExitCode(nil); code != 0 {
+        t.Errorf("got exit code %d for nil, expected 0", code)
+    }
+    if code := flagutil.ExitCode(errors.New("x")); code != 1 {
+        t.Errorf("got exit code %d for generic error, expected 1", code)
+    }
+}
+
+func TestCommandHelp(t *testing.T) {
+    app := new_test_app()
+    err := app.root.Execute([]string{"help", "serve"})
+    if !errors.Is(err, flagutil.ErrHelp) {
+        t.Fatalf("expected ErrHelp, got %v", err)
+    }
+
+    out := app.out.String()
+    for _, want := range []string{
+        "Usage: tool serve [flags] [args]",
+        "Run the server",
+        "-port int",
+        "-v\tVerbose output",
+    } {
+        if !strings.Contains(out, want) {
+            t.Errorf("help output missing %q:\n%s", want, out)
+        }
+    }
+
+    app = new_test_app()
+    app.root.Execute([]string{"help"})
+    out = app.out.String()
+    for _, want := range []string{
+        "Usage: tool [flags] <command> [args]",
+        "Commands:",
+        "serve, s  Run the server",
+        "fail      Always fails",
+    } {
+        if !strings.Contains(out, want) {
+            t.Errorf("help output missing %q:\n%s", want, out)
+        }
+    }
+}
+
+type MigrateFlags struct {
+    Steps int `flagutil:"steps,usage='Number of steps'"`
+}
+
+type DBFlags struct {
+    DSN string `flagutil:"dsn,usage='Database DSN'"`
+    Migrate MigrateFlags `flagutil:"migrate,cmd,usage='Run migrations'"`
+}
+
+type ServeFlags struct {
+    Port int `flagutil:"port,usage='Port to listen on'"`
+}
+
+type CLIFlags struct {
+    Verbose bool `flagutil:"v,usage='Verbose output'"`
+    Serve *ServeFlags `flagutil:"serve,cmd,usage='Run the server'"`
+    DB *DBFlags `flagutil:"db,cmd,usage='Database commands'"`
+}
+
+func TestStructSubcommands(t *testing.T) {
+    flags := flagutil.NewFlagSet("tool", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    data := new(CLIFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    err := flags.Parse([]string{"-v", "serve", "-port", "8080", "x"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if !data.Verbose {
+        t.Errorf("Verbose not set")
+    }
+    if data.Serve == nil || data.Serve.Port != 8080 {
+        t.Errorf("Serve incorrect. Got %+v", data.Serve)
+    }
+    if data.DB != nil {
+        t.Errorf("DB should not be allocated. Got %+v", data.DB)
+    }
+    if flags.Selected() != "serve" {
+        t.Errorf("Selected() incorrect. Got %q, expected %q",
+            flags.Selected(), "serve")
+    }
+    if !reflect.DeepEqual(flags.Args(), []string{"x"}) {
+        t.Errorf("Args() incorrect. Got %v, expected [x]", flags.Args())
+    }
+
+    // Nested subcommands.
+    data = new(CLIFlags)
+    flags = flagutil.NewFlagSet("tool", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.FlagFromStruct(data)
+    err = flags.Parse([]string{"db", "-dsn", "pg://", "migrate", "-steps=2"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if data.DB == nil || data.DB.DSN != "pg://" ||
+        data.DB.Migrate.Steps != 2 {
+        t.Errorf("DB incorrect. Got %+v", data.DB)
+    }
+    if got := flags.Subcommand("db").Selected(); got != "migrate" {
+        t.Errorf("db Selected() incorrect. Got %q, expected %q", got,
+            "migrate")
+    }
+}
+
+func TestStructSubcommandErrors(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("tool", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    data := new(CLIFlags)
+    flags.FlagFromStruct(data)
+
+    err := flags.Parse([]string{"bogus"})
+    var cmd_err *flagutil.CommandError
+    if !errors.As(err, &cmd_err) || cmd_err.Name != "bogus" {
+        t.Errorf("expected a *CommandError, got %T: %v", err, err)
+    }
+    if !strings.Contains(buf.String(), "Commands:\n  serve\n") {
+        t.Errorf("usage doesn't list commands:\n%s", buf.String())
+    }
+
+    err = flags.Parse([]string{"serve", "-port", "x"})
+    var parse_err *flagutil.ParseError
+    if !errors.As(err, &parse_err) || parse_err.FlagSet != "tool serve" {
+        t.Errorf("expected a *ParseError for %q, got %T: %v", "tool serve",
+            err, err)
+    }
+    if data.Serve != nil {
+        t.Errorf("Serve should not be allocated on error")
+    }
+
+    type BadFlags struct {
+        Sub int `flagutil:"sub,cmd"`
+    }
+    err = flags.FlagFromStruct(new(BadFlags))
+    var type_err *flagutil.UnsupportedTypeError
+    if !errors.As(err, &type_err) {
+        t.Errorf("expected a *UnsupportedTypeError, got %T: %v", err, err)
+    }
+}
+
+func TestStructSubcommandsInterspersed(t *testing.T) {
+    flags := flagutil.NewFlagSet("tool", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.SetInterspersed(true)
+    data := new(CLIFlags)
+    flags.FlagFromStruct(data)
+
+    err := flags.Parse([]string{"serve", "x", "-port", "80", "y", "-v"})
+    if err == nil {
+        t.Fatalf("expected an error for a parent flag after the subcommand")
+    }
+
+    err = flags.Parse([]string{"-v", "serve", "x", "-port", "80", "y"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if data.Serve == nil || data.Serve.Port != 80 {
+        t.Errorf("Serve incorrect. Got %+v", data.Serve)
+    }
+    if !reflect.DeepEqual(flags.Args(), []string{"x", "y"}) {
+        t.Errorf("Args() incorrect. Got %v, expected [x y]", flags.Args())
+    }
+}
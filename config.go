@@ -0,0 +1,384 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// A setting read from a config file. The name is the name of a flag. Values
+// are set in order, as if the flag were given once for each value on the
+// command line.
+type ConfigEntry struct {
+    Name string     // Name of the flag.
+    Values []string // Values for the flag.
+    Line int        // Line number in the file (starting at 1), or 0.
+}
+
+// Implemented by config file formats. `ParseConfig()` reads the contents of
+// a config file and returns its settings. Syntax errors should be reported
+// as a `*ConfigError`, with the line number filled in.
+type ConfigFormat interface {
+    ParseConfig(r io.Reader) ([]*ConfigEntry, error)
+}
+
+// Returned when a config file cannot be read or parsed.
+type ConfigError struct {
+    File string // The name of the config file.
+    Line int    // Line number, or 0 if not applicable.
+    Err error   // The underlying cause.
+}
+
+func (e *ConfigError) Error() string {
+    if e.Line > 0 {
+        return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+    }
+    return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// Returns the underlying cause.
+func (e *ConfigError) Unwrap() error {
+    return e.Err
+}
+
+// Config files in JSON format. The file must contain an object whose keys
+// are flag names. Values may be strings, numbers, booleans, or arrays of
+// those (for multi-valued flags). Null values are ignored.
+//
+//   {"host": "db.example.com", "port": 5432, "tag": ["a", "b"]}
+type JSONFormat struct{}
+
+// Parses a JSON config file. See `JSONFormat`.
+func (JSONFormat) ParseConfig(r io.Reader) ([]*ConfigEntry, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+
+    line_at := func(offset int64) int {
+        if offset > int64(len(data)) {
+            offset = int64(len(data))
+        }
+        return bytes.Count(data[:offset], []byte("\n")) + 1
+    }
+
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+
+    syntax_error := func(err error) error {
+        if se, ok := err.(*json.SyntaxError); ok {
+            return &ConfigError{Line: line_at(se.Offset), Err: err}
+        }
+        return &ConfigError{Line: line_at(dec.InputOffset()), Err: err}
+    }
+
+    token, err := dec.Token()
+    if err != nil {
+        return nil, syntax_error(err)
+    }
+    if token != json.Delim('{') {
+        return nil, &ConfigError{Line: line_at(dec.InputOffset()),
+            Err: fmt.Errorf("expected a JSON object")}
+    }
+
+    entries := []*ConfigEntry{}
+    for dec.More() {
+        token, err = dec.Token()
+        if err != nil {
+            return nil, syntax_error(err)
+        }
+        name := token.(string)
+        line := line_at(dec.InputOffset())
+
+        values, err := read_json_values(dec)
+        if err != nil {
+            return nil, syntax_error(fmt.Errorf("value for %q: %w", name,
+                err))
+        }
+        if len(values) == 0 {
+            continue
+        }
+
+        entries = append(entries,
+            &ConfigEntry{Name: name, Values: values, Line: line})
+    }
+
+    if _, err = dec.Token(); err != nil {
+        return nil, syntax_error(err)
+    }
+
+    return entries, nil
+}
+
+// Reads a scalar or an array of scalars from `dec`, converting each value
+// to a string.
+func read_json_values(dec *json.Decoder) ([]string, error) {
+    token, err := dec.Token()
+    if err != nil {
+        return nil, err
+    }
+
+    if token != json.Delim('[') {
+        value, ok, err := json_scalar(token)
+        if err != nil || !ok {
+            return nil, err
+        }
+        return []string{value}, nil
+    }
+
+    values := []string{}
+    for dec.More() {
+        token, err = dec.Token()
+        if err != nil {
+            return nil, err
+        }
+        value, ok, err := json_scalar(token)
+        if err != nil {
+            return nil, err
+        }
+        if ok {
+            values = append(values, value)
+        }
+    }
+
+    // The closing bracket.
+    if _, err = dec.Token(); err != nil {
+        return nil, err
+    }
+
+    return values, nil
+}
+
+// Converts a JSON token to a string. Returns false for null.
+func json_scalar(token interface{}) (string, bool, error) {
+    switch v := token.(type) {
+    case string:
+        return v, true, nil
+    case json.Number:
+        return v.String(), true, nil
+    case bool:
+        return strconv.FormatBool(v), true, nil
+    case nil:
+        return "", false, nil
+    }
+
+    return "", false, fmt.Errorf("unsupported JSON value %v", token)
+}
+
+// Config files made up of "name = value" lines. Blank lines and lines
+// starting with "#" or ";" are ignored. Values may be enclosed in double
+// quotes (with Go escape sequences) or single quotes. A name may be repeated
+// to give multiple values for a multi-valued flag. Section headers, e.g.,
+// "[db]", prefix the names that follow with the section name and a period,
+// so "host" in section "[db]" sets the flag `-db.host`.
+//
+//   # Example
+//   host = db.example.com
+//   port = 5432
+//   tag = a
+//   tag = b
+type KeyValueFormat struct{}
+
+// Parses a key/value config file. See `KeyValueFormat`.
+func (KeyValueFormat) ParseConfig(r io.Reader) ([]*ConfigEntry, error) {
+    scanner := bufio.NewScanner(r)
+    entries := []*ConfigEntry{}
+    section := ""
+    line := 0
+
+    for scanner.Scan() {
+        line++
+        text := strings.TrimSpace(scanner.Text())
+        if text == "" || text[0] == '#' || text[0] == ';' {
+            continue
+        }
+
+        if text[0] == '[' {
+            if text[len(text) - 1] != ']' {
+                return nil, &ConfigError{Line: line,
+                    Err: fmt.Errorf("unterminated section header %q", text)}
+            }
+            section = strings.TrimSpace(text[1:len(text) - 1])
+            continue
+        }
+
+        idx := strings.Index(text, "=")
+        if idx < 1 {
+            return nil, &ConfigError{Line: line,
+                Err: fmt.Errorf("expected name = value, found %q", text)}
+        }
+
+        name := strings.TrimSpace(text[:idx])
+        if section != "" {
+            name = section + "." + name
+        }
+
+        value := strings.TrimSpace(text[idx + 1:])
+        if len(value) >= 2 && value[0] == '"' {
+            unquoted, err := strconv.Unquote(value)
+            if err != nil {
+                return nil, &ConfigError{Line: line,
+                    Err: fmt.Errorf("bad quoted value %s", value)}
+            }
+            value = unquoted
+        } else if len(value) >= 2 && value[0] == '\'' &&
+            value[len(value) - 1] == '\'' {
+            value = value[1:len(value) - 1]
+        }
+
+        entries = append(entries,
+            &ConfigEntry{Name: name, Values: []string{value}, Line: line})
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, &ConfigError{Line: line, Err: err}
+    }
+
+    return entries, nil
+}
+
+// Returns the config format to use for `filename`, based on its extension:
+// `JSONFormat` for ".json", `KeyValueFormat` otherwise.
+func ConfigFormatFor(filename string) ConfigFormat {
+    if strings.EqualFold(filepath.Ext(filename), ".json") {
+        return JSONFormat{}
+    }
+
+    return KeyValueFormat{}
+}
+
+// Sets a config file to read flag values from during `Parse()`. Keys in the
+// file are flag names. Flags that were set on the command line or from the
+// environment are not changed, so the precedence is command line, then
+// environment, then config file, then the default value. If `format` is nil,
+// it is determined by `ConfigFormatFor()`. It is an error for the file not
+// to exist.
+func (fs *FlagSet) SetConfigFile(filename string, format ConfigFormat) {
+    fs.config_file = filename
+    fs.config_format = format
+}
+
+// Defines a string flag (e.g., `-config`) that names a config file to read
+// during `Parse()`, as with `SetConfigFile()`. If the flag has a default
+// value, i.e., `ConfigFlag()` is called with a non-empty `default_file`, and
+// the flag is not given on the command line (or from the environment), it is
+// not an error for that file not to exist. A config file given by the flag
+// takes the place of any set with `SetConfigFile()`.
+func (fs *FlagSet) ConfigFlag(
+    name, default_file, usage string,
+    format ConfigFormat,
+) error {
+    file := default_file
+    if err := fs.Flag(&file, name, usage); err != nil {
+        return err
+    }
+    fs.config_flag = name
+    fs.config_format = format
+
+    return nil
+}
+
+// Sets flags that were not set on the command line or from the environment
+// from the config file, if any.
+func (fs *FlagSet) apply_config() error {
+    set := fs.set_flags()
+
+    filename := fs.config_file
+    must_exist := true
+    if fs.config_flag != "" {
+        if f := fs.flag_flagset.Lookup(fs.config_flag); f != nil &&
+            f.Value.String() != "" {
+            filename = f.Value.String()
+            must_exist = set[fs.config_flag]
+        }
+    }
+    if filename == "" {
+        return nil
+    }
+
+    fh, err := os.Open(filename)
+    if err != nil {
+        if os.IsNotExist(err) && !must_exist {
+            return nil
+        }
+        return &ConfigError{File: filename, Err: err}
+    }
+    defer fh.Close()
+
+    format := fs.config_format
+    if format == nil {
+        format = ConfigFormatFor(filename)
+    }
+
+    entries, err := format.ParseConfig(fh)
+    if err != nil {
+        if config_err, ok := err.(*ConfigError); ok {
+            config_err.File = filename
+            return config_err
+        }
+        return &ConfigError{File: filename, Err: err}
+    }
+
+    for _, entry := range entries {
+        if entry.Name == fs.config_flag {
+            continue
+        }
+
+        source := filename
+        if entry.Line > 0 {
+            source = fmt.Sprintf("%s:%d", filename, entry.Line)
+        }
+
+        if fs.flag_flagset.Lookup(entry.Name) == nil {
+            return &UnknownFlagError{
+                FlagError{Flag: entry.Name, Pos: -1, Source: source},
+            }
+        }
+        if set[entry.Name] {
+            continue
+        }
+
+        for _, value := range entry.Values {
+            if err := fs.flag_flagset.Set(entry.Name, value); err != nil {
+                return &InvalidValueError{
+                    FlagError{Flag: entry.Name, Value: value, Pos: -1,
+                        Source: source, Err: err},
+                }
+            }
+        }
+    }
+
+    return nil
+}
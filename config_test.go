@@ -0,0 +1,164 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type ConfigFlags struct {
+    Host string `flagutil:"host"`
+    Port int `flagutil:"port"`
+    Tags []string `flagutil:"tag,del=','"`
+    Debug bool `flagutil:"debug"`
+    DBName string `flagutil:"db.name"`
+}
+
+func write_file(t *testing.T, name, contents string) string {
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+        t.Fatalf("couldn't write %s: %s", path, err)
+    }
+
+    return path
+}
+
+func TestConfigKeyValue(t *testing.T) {
+    path := write_file(t, "app.conf", `# Comment
+host = "db.example.com"
+port=5432
+tag = a,b
+tag = 'c'
+debug = true
+
+[db]
+name = main
+`)
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(ConfigFlags)
+    flags.FlagFromStruct(data)
+    flags.SetConfigFile(path, nil)
+
+    if err := flags.Parse([]string{"-port", "1234"}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    expected := &ConfigFlags{Host: "db.example.com", Port: 1234,
+        Tags: []string{"a", "b", "c"}, Debug: true, DBName: "main"}
+    if !reflect.DeepEqual(data, expected) {
+        t.Errorf("wrong values. Got %+v, expected %+v", data, expected)
+    }
+}
+
+func TestConfigJSON(t *testing.T) {
+    path := write_file(t, "app.json", `{
+    "host": "db.example.com",
+    "port": 5432,
+    "tag": ["a", "b"],
+    "debug": true,
+    "db.name": null
+}`)
+
+    t.Setenv("APP_HOST", "env.example.com")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetEnvPrefix("APP_")
+    data := new(ConfigFlags)
+    flags.FlagFromStruct(data)
+    flags.ConfigFlag("config", "", "Config file", nil)
+
+    if err := flags.Parse([]string{"-config", path}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    // The environment takes precedence over the config file.
+    expected := &ConfigFlags{Host: "env.example.com", Port: 5432,
+        Tags: []string{"a", "b"}, Debug: true}
+    if !reflect.DeepEqual(data, expected) {
+        t.Errorf("wrong values. Got %+v, expected %+v", data, expected)
+    }
+}
+
+func TestConfigErrors(t *testing.T) {
+    tests := map[string]struct {
+        name string
+        contents string
+        check func(err error) bool
+        line string
+    }{
+        "bad_value": {"app.conf", "host = x\nport = abc\n",
+            func(err error) bool {
+                var e *flagutil.InvalidValueError
+                return errors.As(err, &e) && e.Flag == "port"
+            }, ":2"},
+        "unknown": {"app.conf", "\n\nbogus = 1\n",
+            func(err error) bool {
+                var e *flagutil.UnknownFlagError
+                return errors.As(err, &e) && e.Flag == "bogus"
+            }, ":3"},
+        "syntax": {"app.conf", "host\n",
+            func(err error) bool {
+                var e *flagutil.ConfigError
+                return errors.As(err, &e) && e.Line == 1
+            }, ":1"},
+        "json_value": {"app.json", "{\n  \"host\": \"x\",\n  \"port\": true\n}",
+            func(err error) bool {
+                var e *flagutil.InvalidValueError
+                return errors.As(err, &e) && e.Flag == "port"
+            }, ":3"},
+        "json_syntax": {"app.json", "{\n  \"host\": \"x\",\n  \"port\" 1\n}",
+            func(err error) bool {
+                var e *flagutil.ConfigError
+                return errors.As(err, &e) && e.Line == 3
+            }, ":3"},
+    }
+
+    for name, this_test := range tests {
+        t.Run(name, func(st *testing.T) {
+            path := write_file(st, this_test.name, this_test.contents)
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            flags.SetOutput(io.Discard)
+            flags.FlagFromStruct(new(ConfigFlags))
+            flags.SetConfigFile(path, nil)
+
+            err := flags.Parse([]string{})
+            if err == nil || !this_test.check(err) {
+                st.Errorf("wrong error: %v", err)
+                return
+            }
+            if !strings.Contains(err.Error(), path + this_test.line) {
+                st.Errorf("expected %s%s in error: %s", path, this_test.line,
+                    err)
+            }
+        })
+    }
+}
+
+func TestConfigFlagMissing(t *testing.T) {
+    missing := filepath.Join(t.TempDir(), "missing.conf")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.FlagFromStruct(new(ConfigFlags))
+    flags.ConfigFlag("config", missing, "Config file", nil)
+
+    // A missing default config file is ignored.
+    if err := flags.Parse([]string{}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+    }
+
+    // An explicit one is not.
+    err := flags.Parse([]string{"-config", missing})
+    var config_err *flagutil.ConfigError
+    if !errors.As(err, &config_err) {
+        t.Errorf("expected a *ConfigError, got %v", err)
+    }
+}
@@ -0,0 +1,250 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "encoding"
+    "flag"
+    "net"
+    "reflect"
+    "strconv"
+    "time"
+)
+
+// Converts a command-line argument to a value of a particular type.
+type parse_func func(s string) (reflect.Value, error)
+
+var (
+    flag_value_type = reflect.TypeOf((*flag.Value)(nil)).Elem()
+    text_unmarshaler_type = reflect.TypeOf(
+        (*encoding.TextUnmarshaler)(nil)).Elem()
+    binary_unmarshaler_type = reflect.TypeOf(
+        (*encoding.BinaryUnmarshaler)(nil)).Elem()
+    time_type = reflect.TypeOf(time.Time{})
+)
+
+// Parse functions for types that do not parse themselves and would
+// otherwise be handled incorrectly (or not at all) by kind.
+var type_parse_funcs = map[reflect.Type]parse_func{
+    reflect.TypeOf(time.Duration(0)): func(s string) (reflect.Value, error) {
+        d, err := time.ParseDuration(s)
+        if err != nil {
+            return reflect.Value{}, err
+        }
+        return reflect.ValueOf(d), nil
+    },
+    reflect.TypeOf(net.IPNet{}): parse_ipnet_value,
+    reflect.TypeOf((*net.IPNet)(nil)): parse_ipnet,
+}
+
+// Returns a parse_func for `time.Time` values using `layout` (RFC 3339 if
+// empty).
+func time_parse_func(layout string) parse_func {
+    return func(s string) (reflect.Value, error) {
+        t, err := time.Parse(time_layout(layout), s)
+        if err != nil {
+            return reflect.Value{}, err
+        }
+        return reflect.ValueOf(t), nil
+    }
+}
+
+// Returns a parse_func for `time.Time` or `*time.Time` values using `layout`
+// (RFC 3339 if empty), or nil if `t` is neither type.
+func layout_parse_func(t reflect.Type, layout string) parse_func {
+    switch t {
+    case time_type:
+        return time_parse_func(layout)
+    case reflect.PtrTo(time_type):
+        parse := time_parse_func(layout)
+        return func(s string) (reflect.Value, error) {
+            v, err := parse(s)
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            ptr := reflect.New(time_type)
+            ptr.Elem().Set(v)
+            return ptr, nil
+        }
+    }
+
+    return nil
+}
+
+// Returns a parse_func for values of type `t`. Types with a dedicated parse
+// function (see `type_parse_funcs`) come first, then types that know how to
+// parse themselves (see `unmarshaler_parse_func()`), then the kind of the
+// type.
+func get_parse_func(t reflect.Type) parse_func {
+    if parse, ok := type_parse_funcs[t]; ok {
+        return parse
+    }
+    if parse := unmarshaler_parse_func(t); parse != nil {
+        return parse
+    }
+
+    return kind_parse_func(t)
+}
+
+// Returns a parse_func for types where a pointer to the type implements
+// `flag.Value`, `encoding.TextUnmarshaler`, or `encoding.BinaryUnmarshaler`
+// (checked in that order), e.g., `net.IP` or `big.Int`. If `t` is itself a
+// pointer type, e.g., `*url.URL`, a new value is allocated for each
+// argument. Returns nil if `t` does not implement any of these interfaces.
+func unmarshaler_parse_func(t reflect.Type) parse_func {
+    base_type := t
+    is_ptr := false
+    if t.Kind() == reflect.Ptr {
+        base_type = t.Elem()
+        is_ptr = true
+    }
+
+    var unmarshal func(ptr interface{}, s string) error
+
+    ptr_type := reflect.PtrTo(base_type)
+    switch {
+    case ptr_type.Implements(flag_value_type):
+        unmarshal = func(ptr interface{}, s string) error {
+            return ptr.(flag.Value).Set(s)
+        }
+    case ptr_type.Implements(text_unmarshaler_type):
+        unmarshal = func(ptr interface{}, s string) error {
+            return ptr.(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+        }
+    case ptr_type.Implements(binary_unmarshaler_type):
+        unmarshal = func(ptr interface{}, s string) error {
+            return ptr.(encoding.BinaryUnmarshaler).UnmarshalBinary(
+                []byte(s))
+        }
+    default:
+        return nil
+    }
+
+    return func(s string) (reflect.Value, error) {
+        ptr := reflect.New(base_type)
+        if err := unmarshal(ptr.Interface(), s); err != nil {
+            return reflect.Value{}, err
+        }
+        if is_ptr {
+            return ptr, nil
+        }
+        return ptr.Elem(), nil
+    }
+}
+
+// Returns a parse_func for integers of type `t` in the specified base, as
+// for `strconv.ParseInt()`. Base 0 accepts prefixes such as "0x".
+func integer_parse_func(t reflect.Type, base int) parse_func {
+    switch t.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+        reflect.Int64:
+        return func(s string) (reflect.Value, error) {
+            i, err := strconv.ParseInt(s, base, t.Bits())
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            return reflect.ValueOf(i).Convert(t), nil
+        }
+    }
+
+    return func(s string) (reflect.Value, error) {
+        u, err := strconv.ParseUint(s, base, t.Bits())
+        if err != nil {
+            return reflect.Value{}, err
+        }
+        return reflect.ValueOf(u).Convert(t), nil
+    }
+}
+
+// Element types of slices that are parsed in base 10, for compatibility
+// with the `MultiArg*` types they were originally implemented with. See
+// `NewMultiArgInt()`.
+var decimal_slice_types = []reflect.Type{
+    reflect.TypeOf(int(0)),
+    reflect.TypeOf(int64(0)),
+    reflect.TypeOf(uint(0)),
+    reflect.TypeOf(uint64(0)),
+}
+
+// Returns a parse_func for the elements of slices of type `t`. This is the
+// same as `get_parse_func()`, except as noted for `decimal_slice_types`.
+func slice_parse_func(t reflect.Type) parse_func {
+    for _, decimal_type := range decimal_slice_types {
+        if t == decimal_type {
+            return integer_parse_func(t, 10)
+        }
+    }
+
+    return get_parse_func(t)
+}
+
+// Returns a parse_func that converts arguments to values of type `t`, based
+// on its kind, so that named types (e.g., `type Port uint16`) are supported.
+// Integers are range-checked against the size of the type. Returns nil if
+// the kind is not supported.
+func kind_parse_func(t reflect.Type) parse_func {
+    switch t.Kind() {
+    case reflect.Bool:
+        return func(s string) (reflect.Value, error) {
+            b, err := strconv.ParseBool(s)
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            return reflect.ValueOf(b).Convert(t), nil
+        }
+
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+        reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+        reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return integer_parse_func(t, 0)
+
+    case reflect.Float32, reflect.Float64:
+        return func(s string) (reflect.Value, error) {
+            f, err := strconv.ParseFloat(s, t.Bits())
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            return reflect.ValueOf(f).Convert(t), nil
+        }
+
+    case reflect.Complex64, reflect.Complex128:
+        return func(s string) (reflect.Value, error) {
+            c, err := strconv.ParseComplex(s, t.Bits())
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            return reflect.ValueOf(c).Convert(t), nil
+        }
+
+    case reflect.String:
+        return func(s string) (reflect.Value, error) {
+            return reflect.ValueOf(s).Convert(t), nil
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,125 @@
+package flagutil_test
+
+import (
+    "fmt"
+    flagutil "github.com/cuberat/go-flagutil"
+    "math/big"
+    "net"
+    "net/url"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// An enum implementing flag.Value.
+type Color int
+
+const (
+    ColorNone Color = iota
+    ColorRed
+    ColorBlue
+)
+
+func (c *Color) String() string {
+    if c == nil {
+        return ""
+    }
+    switch *c {
+    case ColorRed:
+        return "red"
+    case ColorBlue:
+        return "blue"
+    }
+    return ""
+}
+
+func (c *Color) Set(s string) error {
+    switch strings.ToLower(s) {
+    case "red":
+        *c = ColorRed
+    case "blue":
+        *c = ColorBlue
+    default:
+        return fmt.Errorf("unknown color %q", s)
+    }
+    return nil
+}
+
+// An enum implementing encoding.TextUnmarshaler only.
+type Level int
+
+func (l *Level) UnmarshalText(text []byte) error {
+    switch string(text) {
+    case "low":
+        *l = 1
+    case "high":
+        *l = 2
+    default:
+        return fmt.Errorf("unknown level %q", text)
+    }
+    return nil
+}
+
+type CustomTypes struct {
+    Color Color `flagutil:"color"`
+    Colors []Color `flagutil:"colors,del=','"`
+    Level Level `flagutil:"level"`
+    IP net.IP `flagutil:"ip"`
+    IPs []net.IP `flagutil:"ips,del=','"`
+    URL *url.URL `flagutil:"url"`
+    Big big.Int `flagutil:"big"`
+}
+
+func TestCustomTypes(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(CustomTypes)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    args := []string{"-color", "blue", "-colors", "red,blue",
+        "-level", "high", "-ip", "10.0.0.1", "-ips", "10.0.0.2,::1",
+        "-url", "https://example.com/x?y=z",
+        "-big", "123456789012345678901234567890"}
+    if err := flags.Parse(args); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if data.Color != ColorBlue {
+        t.Errorf("Color incorrect. Got %d, expected %d", data.Color,
+            ColorBlue)
+    }
+    if !reflect.DeepEqual(data.Colors, []Color{ColorRed, ColorBlue}) {
+        t.Errorf("Colors incorrect. Got %+v", data.Colors)
+    }
+    if data.Level != 2 {
+        t.Errorf("Level incorrect. Got %d, expected 2", data.Level)
+    }
+    if !data.IP.Equal(net.ParseIP("10.0.0.1")) {
+        t.Errorf("IP incorrect. Got %s", data.IP)
+    }
+    if len(data.IPs) != 2 || !data.IPs[1].Equal(net.IPv6loopback) {
+        t.Errorf("IPs incorrect. Got %+v", data.IPs)
+    }
+    if data.URL == nil || data.URL.Host != "example.com" {
+        t.Errorf("URL incorrect. Got %v", data.URL)
+    }
+    if data.Big.String() != "123456789012345678901234567890" {
+        t.Errorf("Big incorrect. Got %s", data.Big.String())
+    }
+}
+
+func TestCustomTypeInvalid(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(new(strings.Builder))
+
+    var level Level
+    flags.Flag(&level, "level", "Level")
+
+    err := flags.Parse([]string{"-level", "medium"})
+    if err == nil || !strings.Contains(err.Error(), `unknown level "medium"`) {
+        t.Errorf("expected an error from UnmarshalText, got %v", err)
+    }
+}
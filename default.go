@@ -58,6 +58,23 @@ func Arg(i int) string {
 // type of the flag is determined from the underlying type of the variable
 // pointed to by `store`.
 //
+// In addition to the types supported by the flag module, `store` may point
+// to a `time.Time`, which is parsed using the `time.RFC3339` layout, or to
+// any other numeric type (e.g., `int8`, `uint16`, `float32`, `complex128`),
+// including named types such as `type Port uint16`. Numeric values are
+// checked against the range of the type.
+//
+// If `store` implements `flag.Value`, it is used as-is. Otherwise, if a
+// pointer to the type of the variable implements `flag.Value`,
+// `encoding.TextUnmarshaler`, or `encoding.BinaryUnmarshaler` (checked in
+// that order), the argument is parsed using the corresponding method. This
+// allows types such as `net.IP`, `*url.URL`, or `big.Int` to be used
+// directly, as well as slices of them. Pointer fields (e.g., `*url.URL`) are
+// allocated as needed.
+//
+// Network addresses are supported via `net.IP`, `net.IPNet` (in CIDR
+// notation, as either a value or a pointer), `netip.Addr`, `netip.Prefix`,
+// `netip.AddrPort`, and `HostPort` (a validated "host:port" pair).
 //
 // If `store` is a pointer to a supported slice type, the same flag will be
 // accepted multiple times on the command line, with each value stored in the
@@ -68,6 +85,14 @@ func Arg(i int) string {
 // - []uint64
 // - []float64
 // - []string
+// - []time.Duration
+// - []time.Time
+// - slices of any other numeric, bool, or string kind
+// - slices of types that parse themselves, as described above
+//
+// Similarly, if `store` is a pointer to a map, e.g., `map[string]string` or
+// `map[string]int`, the flag may be repeated, with each argument of the form
+// "key=value". Keys and values may be of any supported scalar type.
 //
 // See `FlagSep()` for supporting multiple values specified in a single
 // command line argument.
@@ -79,11 +104,40 @@ func Flag(store interface{}, name, usage string) error {
 // multiple when `store` is a slice. When a delimiter is specified, the
 // arguments may be specified as both multiple command-line arguments and
 // single command-line arguments with multiple values separated by the
-// specified delimiter.
+// specified delimiter. Use `SetSplit()` to allow quoted values that contain
+// the delimiter.
+//
+// By default, values given for a slice replace the slice's initial value.
+// Use `SetSlicePolicy()` after defining the flag to append to it instead.
+// An empty argument (e.g., "-tag=") clears the slice.
 func FlagSep(store interface{}, name, usage, del string) error {
     return CommandLine.FlagSep(store, name, usage, del)
 }
 
+// Sets how arguments for a multi-valued command-line flag are split on its
+// delimiter. See `FlagSet.SetSplit()`.
+func SetSplit(name string, opts SplitOptions) error {
+    return CommandLine.SetSplit(name, opts)
+}
+
+// Sets the syntax used to parse the command-line flags. See
+// `FlagSet.SetSyntax()`.
+func SetSyntax(syntax Syntax) {
+    CommandLine.SetSyntax(syntax)
+}
+
+// Sets whether command-line flags may follow non-flag arguments. See
+// `FlagSet.SetInterspersed()`.
+func SetInterspersed(interspersed bool) {
+    CommandLine.SetInterspersed(interspersed)
+}
+
+// Like `Flag()`, except also define a one-character alias for the flag,
+// e.g., "v" for "verbose". See `FlagSet.SetSyntax()`.
+func FlagShort(store interface{}, name, usage, short string) error {
+    return CommandLine.FlagShort(store, name, usage, short)
+}
+
 // Like `Flag()`, except that `store` must be a pointer to a struct. Exported
 // fields (ones starting with capital letters) from the struct that have a tag
 // `flagutil` are examined to determine the name of the flag and the usage
@@ -92,6 +146,88 @@ func FlagFromStruct(store interface{}) error {
     return CommandLine.FlagFromStruct(store)
 }
 
+// Sets a prefix used to derive an environment variable name for every
+// command-line flag. See `FlagSet.SetEnvPrefix()` for details.
+func SetEnvPrefix(prefix string) {
+    CommandLine.SetEnvPrefix(prefix)
+}
+
+// Sets the environment variable used for a command-line flag. See
+// `FlagSet.SetEnv()`.
+func SetEnv(name, env_var string) error {
+    return CommandLine.SetEnv(name, env_var)
+}
+
+// Sets a config file to read command-line flag values from during
+// `Parse()`. See `FlagSet.SetConfigFile()`.
+func SetConfigFile(filename string, format ConfigFormat) {
+    CommandLine.SetConfigFile(filename, format)
+}
+
+// Defines a command-line flag that names a config file to read during
+// `Parse()`. See `FlagSet.ConfigFlag()`.
+func ConfigFlag(name, default_file, usage string, format ConfigFormat) error {
+    return CommandLine.ConfigFlag(name, default_file, usage, format)
+}
+
+// Marks a command-line flag as required. See `FlagSet.MarkRequired()`.
+func MarkRequired(name string) error {
+    return CommandLine.MarkRequired(name)
+}
+
+// Restricts the values of a command-line flag. See `FlagSet.SetChoices()`.
+func SetChoices(name string, choices []string, ignore_case bool) error {
+    return CommandLine.SetChoices(name, choices, ignore_case)
+}
+
+// Adds a constraint on the values of a command-line flag. See
+// `FlagSet.SetConstraint()`.
+func SetConstraint(name, constraint, limit string) error {
+    return CommandLine.SetConstraint(name, constraint, limit)
+}
+
+// Declares that at most one of the command-line flags `names` may be set.
+// See `FlagSet.MutuallyExclusive()`.
+func MutuallyExclusive(names ...string) error {
+    return CommandLine.MutuallyExclusive(names...)
+}
+
+// Declares that at least one of the command-line flags `names` must be set.
+// See `FlagSet.AtLeastOne()`.
+func AtLeastOne(names ...string) error {
+    return CommandLine.AtLeastOne(names...)
+}
+
+// Declares that if the command-line flag `name` is set, the flags `required`
+// must also be set. See `FlagSet.DependsOn()`.
+func DependsOn(name string, required ...string) error {
+    return CommandLine.DependsOn(name, required...)
+}
+
+// Adds a function to validate the value of a command-line flag after
+// parsing. See `FlagSet.AddValidator()`.
+func AddValidator(name string, validator func(value interface{}) error) error {
+    return CommandLine.AddValidator(name, validator)
+}
+
+// Sets how the values given for a slice command-line flag are combined with
+// its default. See `FlagSet.SetSlicePolicy()`.
+func SetSlicePolicy(name string, policy SlicePolicy) error {
+    return CommandLine.SetSlicePolicy(name, policy)
+}
+
+// Returns the FlagSet for a subcommand declared via `FlagFromStruct()`. See
+// `FlagSet.Subcommand()`.
+func Subcommand(name string) *FlagSet {
+    return CommandLine.Subcommand(name)
+}
+
+// Returns the name of the subcommand selected by `Parse()`. See
+// `FlagSet.Selected()`.
+func Selected() string {
+    return CommandLine.Selected()
+}
+
 // Parse parses the command-line flags from os.Args[1:]. Must be called after
 // all flags are defined and before flags are accessed by the program.
 func Parse() error {
@@ -0,0 +1,302 @@
+package flagutil_test
+
+import (
+    "bytes"
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+type DefaultFlags struct {
+    Host string `flagutil:"host,default='localhost',usage='Host'"`
+    Port int `flagutil:"port,default=8080,usage='Port'"`
+    Wait time.Duration `flagutil:"wait,default=1m30s,usage='Wait'"`
+    Tags []string `flagutil:"tag,del=',',default='a,b',usage='Tags'"`
+    Limits map[string]int `flagutil:"limit,del=',',default='cpu=2',usage='Limits'"`
+    Start time.Time `flagutil:"start,layout='2006-01-02',default='2020-01-02',usage='Start'"`
+    Debug bool `flagutil:"debug,default=true,usage='Debug'"`
+}
+
+func TestTagDefaults(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(DefaultFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    expected := DefaultFlags{
+        Host: "localhost",
+        Port: 8080,
+        Wait: 90 * time.Second,
+        Tags: []string{"a", "b"},
+        Limits: map[string]int{"cpu": 2},
+        Start: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+        Debug: true,
+    }
+    if !reflect.DeepEqual(*data, expected) {
+        t.Errorf("got %+v, expected %+v", *data, expected)
+    }
+
+    err := flags.Parse([]string{"-port", "9090", "-tag", "c", "-debug=false"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    expected.Port = 9090
+    expected.Tags = []string{"c"}
+    expected.Debug = false
+    if !reflect.DeepEqual(*data, expected) {
+        t.Errorf("got %+v, expected %+v", *data, expected)
+    }
+}
+
+func TestTagDefaultsPrintDefaults(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    if err := flags.FlagFromStruct(new(DefaultFlags)); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    flags.PrintDefaults()
+
+    for _, want := range []string{
+        "\tHost (default \"localhost\")\n",
+        "\tPort (default 8080)\n",
+        "\tWait (default 1m30s)\n",
+        "\tTags (default a,b)\n",
+        "\tLimits (default cpu=2)\n",
+        "\tStart (default 2020-01-02)\n",
+        "\tDebug (default true)\n",
+    } {
+        if !strings.Contains(buf.String(), want) {
+            t.Errorf("defaults missing %q:\n%s", want, buf.String())
+        }
+    }
+}
+
+func TestTagDefaultInvalid(t *testing.T) {
+    type BadDefault struct {
+        Port uint8 `flagutil:"port,default=300"`
+    }
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    err := flags.FlagFromStruct(new(BadDefault))
+    var inv_err *flagutil.InvalidValueError
+    if !errors.As(err, &inv_err) || inv_err.Flag != "port" ||
+        inv_err.Value != "300" {
+        t.Errorf("expected an *InvalidValueError, got %T: %v", err, err)
+    }
+}
+
+func TestTagDefaultChecks(t *testing.T) {
+    tests := map[string]interface{}{
+        "choices": &struct {
+            Fmt string `flagutil:"fmt,choices='json|text',default='xml'"`
+        }{},
+        "min": &struct {
+            N int `flagutil:"n,min=5,default='1'"`
+        }{},
+        "pattern": &struct {
+            ID string `flagutil:"id,pattern='[a-z]+',default='A1'"`
+        }{},
+        "each value": &struct {
+            Tags []string `flagutil:"tag,del=',',maxlen=2,default='ab,abc'"`
+        }{},
+        "mincount": &struct {
+            Tags []string `flagutil:"tag,del=',',mincount=2,default='a'"`
+        }{},
+    }
+
+    for name, data := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            err := flags.FlagFromStruct(data)
+
+            var inv_err *flagutil.InvalidValueError
+            if !errors.As(err, &inv_err) || inv_err.Source != "default" {
+                st.Errorf("expected an *InvalidValueError from the " +
+                    "default, got %T: %v", err, err)
+            }
+        })
+    }
+
+    // A default that satisfies the checks is fine.
+    type GoodDefault struct {
+        Fmt string `flagutil:"fmt,choices='json|text',nocase,default='JSON'"`
+        Tags []string `flagutil:"tag,del=',',mincount=2,default='a,b'"`
+    }
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(GoodDefault)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    if err := flags.Parse(nil); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if data.Fmt != "json" {
+        t.Errorf("got %q, expected %q", data.Fmt, "json")
+    }
+}
+
+func TestTagDefaultUnsupported(t *testing.T) {
+    type Nested struct {
+        Host string `flagutil:"host"`
+    }
+
+    tests := map[string]interface{}{
+        "positional": &struct {
+            Files []string `flagutil:"files,pos=0,default='a'"`
+        }{},
+        "subcommand": &struct {
+            Serve *Nested `flagutil:"serve,cmd,default='a'"`
+        }{},
+        "nested": &struct {
+            DB Nested `flagutil:"db,default='a'"`
+        }{},
+    }
+
+    for name, data := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            err := flags.FlagFromStruct(data)
+
+            var tag_err *flagutil.TagError
+            if !errors.As(err, &tag_err) {
+                st.Errorf("expected a *TagError, got %T: %v", err, err)
+            }
+        })
+    }
+}
+
+type PolicyFlags struct {
+    Replace []string `flagutil:"replace,del=',',default='a,b',usage='Replace'"`
+    Append []string `flagutil:"append,del=',',slice='append',default='a,b',usage='Append'"`
+    Ports []int `flagutil:"port,slice='append',default='80',usage='Ports'"`
+}
+
+func TestSlicePolicy(t *testing.T) {
+    tests := []struct {
+        args []string
+        expected PolicyFlags
+    }{
+        {[]string{},
+            PolicyFlags{[]string{"a", "b"}, []string{"a", "b"}, []int{80}}},
+        {[]string{"-replace", "c", "-append", "c,d", "-port", "443"},
+            PolicyFlags{[]string{"c"}, []string{"a", "b", "c", "d"},
+                []int{80, 443}}},
+        {[]string{"-replace=", "-append=", "-port="},
+            PolicyFlags{[]string{}, []string{}, []int{}}},
+        {[]string{"-replace", "c", "-replace=", "-replace", "d",
+            "-append", "c", "-append", "", "-append", "d"},
+            PolicyFlags{[]string{"d"}, []string{"d"}, []int{80}}},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        data := new(PolicyFlags)
+        if err := flags.FlagFromStruct(data); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+        if err := flags.Parse(test.args); err != nil {
+            t.Errorf("%v: error parsing flags: %s", test.args, err)
+            continue
+        }
+        if !reflect.DeepEqual(*data, test.expected) {
+            t.Errorf("%v: got %+v, expected %+v", test.args, *data,
+                test.expected)
+        }
+    }
+
+    // The default replaces any value the field already has.
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := &PolicyFlags{Append: []string{"pre"}, Ports: []int{1}}
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    if err := flags.Parse([]string{"-append", "c"}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    expected := PolicyFlags{[]string{"a", "b"}, []string{"a", "b", "c"},
+        []int{80}}
+    if !reflect.DeepEqual(*data, expected) {
+        t.Errorf("got %+v, expected %+v", *data, expected)
+    }
+}
+
+type PolicyCountFlags struct {
+    Replace []string `flagutil:"replace,del=',',default='a,b',maxcount=2,usage='Replace'"`
+    Append []string `flagutil:"append,del=',',slice='append',default='a,b',maxcount=3,usage='Append'"`
+}
+
+func TestSlicePolicyMaxCount(t *testing.T) {
+    tests := []struct {
+        args []string
+        ok bool
+    }{
+        // Values discarded by the reset token don't count.
+        {[]string{"-replace", "a,b", "-replace=", "-replace", "c"}, true},
+        {[]string{"-append", "c", "-append=", "-append", "d,e,f"}, true},
+        // The default counts when it is kept.
+        {[]string{"-replace", "c,d"}, true},
+        {[]string{"-append", "c"}, true},
+        {[]string{"-append", "c,d"}, false},
+        {[]string{"-replace", "c,d,e"}, false},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        if err := flags.FlagFromStruct(new(PolicyCountFlags)); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        if test.ok && err != nil {
+            t.Errorf("%v: unexpected error: %s", test.args, err)
+        }
+        var c_err *flagutil.ConstraintError
+        if !test.ok && !errors.As(err, &c_err) {
+            t.Errorf("%v: expected a *ConstraintError, got %v", test.args,
+                err)
+        }
+    }
+}
+
+func TestSetSlicePolicy(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    tags := []string{"default"}
+    count := 0
+    flags.FlagSep(&tags, "tag", "Tags", ",")
+    flags.Flag(&count, "count", "Count")
+    flags.SetChoices("tag", []string{"default", "x", "y"}, false)
+
+    if err := flags.SetSlicePolicy("tag", flagutil.SliceAppend); err != nil {
+        t.Fatalf("error setting slice policy: %s", err)
+    }
+    if err := flags.SetSlicePolicy("count", flagutil.SliceAppend); err == nil {
+        t.Errorf("expected an error for a non-slice flag")
+    }
+
+    if err := flags.Parse([]string{"-tag", "x,y"}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    expected := []string{"default", "x", "y"}
+    if !reflect.DeepEqual(tags, expected) {
+        t.Errorf("got %v, expected %v", tags, expected)
+    }
+
+    // The reset token is not checked against the choices.
+    flags = flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    tags = []string{"default"}
+    flags.FlagSep(&tags, "tag", "Tags", ",")
+    flags.SetChoices("tag", []string{"default", "x", "y"}, false)
+    if err := flags.Parse([]string{"-tag="}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if len(tags) != 0 {
+        t.Errorf("got %v, expected an empty slice", tags)
+    }
+}
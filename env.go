@@ -0,0 +1,128 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "flag"
+    "os"
+    "strings"
+    "unicode"
+)
+
+// Sets a prefix used to derive an environment variable name for every flag
+// in the set, e.g., with the prefix "MYAPP_", the flag `-db-host` may be set
+// with the environment variable `MYAPP_DB_HOST`. The flag name is converted
+// to upper case, and characters other than letters and digits are replaced
+// with underscores.
+//
+// Flags that were not set on the command line are set from the environment
+// during `Parse()`, so the precedence is command line, then environment,
+// then the default value. Environment variables that are set to an empty
+// string are ignored. Multi-valued flags are split on the flag's delimiter,
+// as on the command line.
+func (fs *FlagSet) SetEnvPrefix(prefix string) {
+    fs.env_prefix = prefix
+}
+
+// Sets the environment variable used for flag `name`, overriding any name
+// derived from the prefix set with `SetEnvPrefix()`. This is equivalent to
+// the "env" key in a struct tag. See `SetEnvPrefix()` for details.
+func (fs *FlagSet) SetEnv(name, env_var string) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    spec.opts.env = env_var
+
+    return nil
+}
+
+// Returns the environment variable for flag `name`, or "" if there is none.
+func (fs *FlagSet) env_var(name string) string {
+    if spec, ok := fs.specs[name]; ok && spec.opts.env != "" {
+        return spec.opts.env
+    }
+
+    if fs.env_prefix == "" {
+        return ""
+    }
+
+    env_name := strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return unicode.ToUpper(r)
+        }
+        return '_'
+    }, name)
+
+    return fs.env_prefix + env_name
+}
+
+// Returns the set of flags that have been set so far, including persistent
+// flags set by an ancestor command (see `Command`).
+func (fs *FlagSet) set_flags() map[string]bool {
+    set := make(map[string]bool)
+    for name := range fs.inherited {
+        set[name] = true
+    }
+    fs.flag_flagset.Visit(func(f *flag.Flag) {
+        set[f.Name] = true
+    })
+
+    return set
+}
+
+// Sets flags that were not set on the command line from the environment.
+func (fs *FlagSet) apply_env() error {
+    set := fs.set_flags()
+
+    var err error
+    fs.flag_flagset.VisitAll(func(f *flag.Flag) {
+        if err != nil || set[f.Name] {
+            return
+        }
+
+        env_var := fs.env_var(f.Name)
+        if env_var == "" {
+            return
+        }
+
+        value := os.Getenv(env_var)
+        if value == "" {
+            return
+        }
+
+        if set_err := fs.flag_flagset.Set(f.Name, value); set_err != nil {
+            err = &InvalidValueError{
+                FlagError{Flag: f.Name, Value: value, Pos: -1,
+                    Source: "environment variable " + env_var,
+                    Err: set_err},
+            }
+        }
+    })
+
+    return err
+}
@@ -0,0 +1,124 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type EnvFlags struct {
+    Host string `flagutil:"db-host,usage='Database host'"`
+    Port int `flagutil:"port,env='SERVICE_PORT',usage='Port'"`
+    Tags []string `flagutil:"tag,del=',',usage='Tags'"`
+    Verbose bool `flagutil:"v,usage='Verbose'"`
+}
+
+func TestEnvFallback(t *testing.T) {
+    t.Setenv("MYAPP_DB_HOST", "db.example.com")
+    t.Setenv("SERVICE_PORT", "5432")
+    t.Setenv("MYAPP_PORT", "1")
+    t.Setenv("MYAPP_TAG", "a,b")
+    t.Setenv("MYAPP_V", "")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetEnvPrefix("MYAPP_")
+    data := new(EnvFlags)
+    data.Host = "localhost"
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    if err := flags.Parse([]string{"-tag", "c"}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if data.Host != "db.example.com" {
+        t.Errorf("Host incorrect. Got %q, expected %q", data.Host,
+            "db.example.com")
+    }
+    if data.Port != 5432 {
+        t.Errorf("Port incorrect. Got %d, expected 5432", data.Port)
+    }
+    // The command line takes precedence.
+    if !reflect.DeepEqual(data.Tags, []string{"c"}) {
+        t.Errorf("Tags incorrect. Got %+v, expected [c]", data.Tags)
+    }
+    if data.Verbose {
+        t.Errorf("Verbose set from empty environment variable")
+    }
+}
+
+func TestEnvSlice(t *testing.T) {
+    t.Setenv("MYAPP_TAG", "a,b")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetEnvPrefix("MYAPP_")
+    data := new(EnvFlags)
+    flags.FlagFromStruct(data)
+
+    if err := flags.Parse([]string{}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if !reflect.DeepEqual(data.Tags, []string{"a", "b"}) {
+        t.Errorf("Tags incorrect. Got %+v, expected [a b]", data.Tags)
+    }
+}
+
+func TestEnvInvalid(t *testing.T) {
+    t.Setenv("LIMIT", "lots")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    limit := 0
+    flags.Flag(&limit, "limit", "Limit")
+    if err := flags.SetEnv("limit", "LIMIT"); err != nil {
+        t.Errorf("error setting env: %s", err)
+        return
+    }
+    if err := flags.SetEnv("bogus", "BOGUS"); err == nil {
+        t.Errorf("expected an error setting env for an unknown flag")
+    }
+
+    err := flags.Parse([]string{})
+    var inv_err *flagutil.InvalidValueError
+    if !errors.As(err, &inv_err) {
+        t.Errorf("expected an *InvalidValueError, got %v", err)
+        return
+    }
+    if inv_err.Flag != "limit" || inv_err.Pos != -1 ||
+        !strings.Contains(inv_err.Source, "LIMIT") {
+        t.Errorf("wrong details in error: %+v", inv_err.FlagError)
+    }
+}
+
+func TestEnvPrintDefaults(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetEnvPrefix("MYAPP_")
+    data := new(EnvFlags)
+    data.Host = "localhost"
+    flags.FlagFromStruct(data)
+
+    writer := new(strings.Builder)
+    flags.SetOutput(writer)
+    flags.PrintDefaults()
+
+    expected := `  -db-host string
+    	Database host (default "localhost") (env: MYAPP_DB_HOST)
+  -port int
+    	Port (env: SERVICE_PORT)
+  -tag value
+    	Tags (env: MYAPP_TAG)
+  -v	Verbose (env: MYAPP_V)
+`
+    if writer.String() != expected {
+        t.Errorf("wrong output. Got:\n%s\nExpected:\n%s", writer.String(),
+            expected)
+    }
+}
@@ -0,0 +1,288 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "flag"
+    "fmt"
+    "reflect"
+)
+
+// ErrHelp is the error returned by `Parse()` if the -help or -h flag is
+// invoked but no such flag is defined.
+var ErrHelp = flag.ErrHelp
+
+// Returned by `Parse()` when the command line could not be parsed. The
+// underlying error is available via `Unwrap()` (or `errors.As()`), and is
+// normally one of the flag error types below, e.g., `*InvalidValueError`.
+type ParseError struct {
+    FlagSet string // Name of the FlagSet being parsed.
+    Err error      // The underlying error.
+}
+
+// Returns the message of the underlying error.
+func (e *ParseError) Error() string {
+    return e.Err.Error()
+}
+
+// Returns the underlying error.
+func (e *ParseError) Unwrap() error {
+    return e.Err
+}
+
+// Details common to errors relating to a single flag. It is embedded in each
+// of the flag error types.
+type FlagError struct {
+    Flag string   // Name of the flag, without leading dashes.
+    Value string  // The offending command-line argument, if any.
+    Pos int       // Index of the offending argument in argv, or -1.
+    Source string // Where the value came from, if not the command line.
+    Err error     // The underlying cause, if any.
+}
+
+// Returns the underlying cause.
+func (e *FlagError) Unwrap() error {
+    return e.Err
+}
+
+// Returns the details of the error. Since `FlagError` is embedded in each of
+// the flag error types, this lets callers get at the details without
+// knowing the specific type, e.g.:
+//
+//  var fd flagutil.FlagDetailer
+//  if errors.As(err, &fd) {
+//      fmt.Println(fd.FlagDetails().Flag)
+//  }
+func (e *FlagError) FlagDetails() *FlagError {
+    return e
+}
+
+// Implemented by each of the flag error types (those that embed
+// `FlagError`). See `FlagError.FlagDetails()`.
+type FlagDetailer interface {
+    error
+    FlagDetails() *FlagError
+}
+
+// Returned when a flag on the command line has not been defined.
+type UnknownFlagError struct {
+    FlagError
+}
+
+func (e *UnknownFlagError) Error() string {
+    if e.Source != "" {
+        return fmt.Sprintf("flag provided but not defined: -%s (in %s)",
+            e.Flag, e.Source)
+    }
+    return fmt.Sprintf("flag provided but not defined: -%s", e.Flag)
+}
+
+// Returned when a flag that requires a value is the last argument on the
+// command line.
+type MissingValueError struct {
+    FlagError
+}
+
+func (e *MissingValueError) Error() string {
+    return fmt.Sprintf("flag needs an argument: -%s", e.Flag)
+}
+
+// Returned when the value for a flag could not be converted to the type of
+// the flag. `Err` holds the error from the conversion, e.g., a
+// `*strconv.NumError`.
+type InvalidValueError struct {
+    FlagError
+}
+
+func (e *InvalidValueError) Error() string {
+    if e.Source != "" {
+        return fmt.Sprintf("invalid value %q for flag -%s from %s: %v",
+            e.Value, e.Flag, e.Source, e.Err)
+    }
+    return fmt.Sprintf("invalid value %q for flag -%s: %v", e.Value, e.Flag,
+        e.Err)
+}
+
+// Returned when a command-line argument looks like a flag, but is not
+// well-formed, e.g., "---x" or "-=x".
+type FlagSyntaxError struct {
+    FlagError
+}
+
+func (e *FlagSyntaxError) Error() string {
+    return fmt.Sprintf("bad flag syntax: %s", e.Value)
+}
+
+// Returned when flags marked as required were not set on the command line,
+// from the environment, or from a config file. All missing flags are
+// reported at once.
+type RequiredFlagError struct {
+    Flags []string // Names of the missing flags, without leading dashes.
+}
+
+func (e *RequiredFlagError) Error() string {
+    if len(e.Flags) == 1 {
+        return fmt.Sprintf("missing required flag: -%s", e.Flags[0])
+    }
+    return fmt.Sprintf("missing required flags: %s", dash_list(e.Flags))
+}
+
+// Returned when the flags that were set violate a relationship declared via
+// `MutuallyExclusive()`, `AtLeastOne()`, `DependsOn()`, or the equivalent
+// struct tag keys.
+type FlagGroupError struct {
+    Relation string // "exclusive", "atleastone", or "requires".
+    Flag string     // For "requires", the flag that requires the others.
+
+    // For "exclusive", the flags that were set together. For "atleastone",
+    // the flags in the group. For "requires", the missing flags.
+    Flags []string
+}
+
+func (e *FlagGroupError) Error() string {
+    switch e.Relation {
+    case "exclusive":
+        return fmt.Sprintf("flags %s can't be used together",
+            dash_list(e.Flags))
+    case "atleastone":
+        return fmt.Sprintf("one of the flags %s is required",
+            dash_list(e.Flags))
+    }
+    return fmt.Sprintf("flag -%s requires %s", e.Flag, dash_list(e.Flags))
+}
+
+// Returned when a value violates a constraint declared via
+// `SetConstraint()` or a struct tag key such as "min" or "pattern". When
+// returned for a single value, it is wrapped in an `*InvalidValueError`,
+// which names the flag, and `Flag` is empty.
+type ConstraintError struct {
+    Flag string       // Name of the flag, if not given by a wrapping error.
+    Constraint string // The constraint, e.g., "min".
+    Limit string      // The limit given for the constraint, e.g., "1".
+}
+
+func (e *ConstraintError) Error() string {
+    var msg string
+    switch e.Constraint {
+    case "min":
+        msg = fmt.Sprintf("must be at least %s", e.Limit)
+    case "max":
+        msg = fmt.Sprintf("must be at most %s", e.Limit)
+    case "minlen":
+        msg = fmt.Sprintf("must be at least %s characters long", e.Limit)
+    case "maxlen":
+        msg = fmt.Sprintf("must be at most %s characters long", e.Limit)
+    case "pattern":
+        msg = "must match the pattern"
+    case "mincount":
+        msg = fmt.Sprintf("must have at least %s values", e.Limit)
+    case "maxcount":
+        msg = fmt.Sprintf("must have at most %s values", e.Limit)
+    default:
+        msg = fmt.Sprintf("must satisfy %s=%s", e.Constraint, e.Limit)
+    }
+    msg += fmt.Sprintf(" (%s=%s)", e.Constraint, e.Limit)
+
+    if e.Flag != "" {
+        return fmt.Sprintf("flag -%s %s", e.Flag, msg)
+    }
+    return msg
+}
+
+// Returned when the non-flag arguments don't match the positional arguments
+// declared via `FlagFromStruct()`: an argument is missing, there are too
+// many, or one could not be converted to the type of its field.
+type ArgumentError struct {
+    Name string  // Name of the positional argument, or "" if unexpected.
+    Value string // The offending argument, if any.
+    Pos int      // Index of the argument in `Args()`.
+    Err error    // The underlying cause, if any.
+}
+
+func (e *ArgumentError) Error() string {
+    switch {
+    case e.Name == "":
+        return fmt.Sprintf("unexpected argument %q", e.Value)
+    case e.Err != nil:
+        return fmt.Sprintf("invalid value %q for argument %s: %v", e.Value,
+            e.Name, e.Err)
+    }
+    return fmt.Sprintf("missing argument %s", e.Name)
+}
+
+// Returns the underlying cause.
+func (e *ArgumentError) Unwrap() error {
+    return e.Err
+}
+
+// Returned by `Flag()`, `FlagSep()`, and `FlagFromStruct()` when the
+// variable to bind a flag to is of a type that flagutil does not support.
+type UnsupportedTypeError struct {
+    FlagError
+    Type reflect.Type // The type that is not supported (may be nil).
+}
+
+func (e *UnsupportedTypeError) Error() string {
+    if e.Err != nil {
+        return fmt.Sprintf("unsupported type %v for flag %q: %v", e.Type,
+            e.Flag, e.Err)
+    }
+    return fmt.Sprintf("unsupported type %v for flag %q", e.Type, e.Flag)
+}
+
+func unsupported_type_error(name string, t reflect.Type,
+    err error) *UnsupportedTypeError {
+    return &UnsupportedTypeError{
+        FlagError: FlagError{Flag: name, Pos: -1, Err: err},
+        Type: t,
+    }
+}
+
+// Returned by `FlagFromStruct()` when the `flagutil` tag on a struct field
+// cannot be parsed.
+type TagError struct {
+    Struct string   // Name of the struct type.
+    Field string    // Name of the struct field.
+    Tag string      // The contents of the `flagutil` tag.
+    Column int      // Column in the tag (starting at 1), or 0.
+    Expected string // Description of what was expected at `Column`.
+    Err error       // The underlying cause.
+}
+
+func (e *TagError) Error() string {
+    if e.Column > 0 {
+        return fmt.Sprintf("bad flagutil tag on field %s.%s at column %d: %v",
+            e.Struct, e.Field, e.Column, e.Err)
+    }
+    return fmt.Sprintf("bad flagutil tag on field %s.%s: %v", e.Struct,
+        e.Field, e.Err)
+}
+
+// Returns the underlying cause.
+func (e *TagError) Unwrap() error {
+    return e.Err
+}
@@ -0,0 +1,175 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "strconv"
+    "testing"
+)
+
+func TestParseErrorTypes(t *testing.T) {
+    type err_test struct {
+        args []string
+        check func(err error) bool
+        flag string
+        value string
+        pos int
+    }
+
+    tests := map[string]*err_test{
+        "unknown": &err_test{
+            args: []string{"-cnt", "1", "-bogus", "x"},
+            check: func(err error) bool {
+                var e *flagutil.UnknownFlagError
+                return errors.As(err, &e)
+            },
+            flag: "bogus", value: "-bogus", pos: 2,
+        },
+        "missing": &err_test{
+            args: []string{"-name", "x", "-cnt"},
+            check: func(err error) bool {
+                var e *flagutil.MissingValueError
+                return errors.As(err, &e)
+            },
+            flag: "cnt", value: "-cnt", pos: 2,
+        },
+        "invalid": &err_test{
+            args: []string{"-name", "x", "-cnt", "abc"},
+            check: func(err error) bool {
+                var e *flagutil.InvalidValueError
+                return errors.As(err, &e)
+            },
+            flag: "cnt", value: "abc", pos: 3,
+        },
+        "invalid_eq": &err_test{
+            args: []string{"-nums=1,x"},
+            check: func(err error) bool {
+                var e *flagutil.InvalidValueError
+                var num_err *strconv.NumError
+                return errors.As(err, &e) && errors.As(err, &num_err)
+            },
+            flag: "nums", value: "1,x", pos: 0,
+        },
+        "syntax": &err_test{
+            args: []string{"---cnt"},
+            check: func(err error) bool {
+                var e *flagutil.FlagSyntaxError
+                return errors.As(err, &e)
+            },
+            flag: "", value: "---cnt", pos: 0,
+        },
+    }
+
+    for name, this_test := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            flags.SetOutput(io.Discard)
+            cnt := 0
+            str := ""
+            nums := []int{}
+            flags.Flag(&cnt, "cnt", "Count")
+            flags.Flag(&str, "name", "Name")
+            flags.FlagSep(&nums, "nums", "Numbers", ",")
+
+            err := flags.Parse(this_test.args)
+            if err == nil {
+                st.Errorf("expected an error")
+                return
+            }
+
+            if !this_test.check(err) {
+                st.Errorf("wrong error type %T: %s", errors.Unwrap(err), err)
+                return
+            }
+
+            var parse_err *flagutil.ParseError
+            if !errors.As(err, &parse_err) {
+                st.Errorf("expected a *ParseError, got %T", err)
+                return
+            }
+
+            // All of the flag error types embed FlagError.
+            var fd flagutil.FlagDetailer
+            if !errors.As(err, &fd) {
+                st.Errorf("expected a FlagDetailer, got %T", parse_err.Err)
+                return
+            }
+            fe := fd.FlagDetails()
+
+            if fe.Flag != this_test.flag || fe.Value != this_test.value ||
+                fe.Pos != this_test.pos {
+                st.Errorf("wrong details. Got (%q, %q, %d), " +
+                    "expected (%q, %q, %d)", fe.Flag, fe.Value, fe.Pos,
+                    this_test.flag, this_test.value, this_test.pos)
+            }
+        })
+    }
+}
+
+func TestUnsupportedTypeError(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+
+    var ch chan int
+    err := flags.Flag(&ch, "ch", "A channel")
+    var e *flagutil.UnsupportedTypeError
+    if !errors.As(err, &e) {
+        t.Errorf("expected an *UnsupportedTypeError, got %T: %v", err, err)
+        return
+    }
+    if e.Flag != "ch" {
+        t.Errorf("wrong flag name. Got %q, expected %q", e.Flag, "ch")
+    }
+
+    type bad_struct struct {
+        Ch chan int `flagutil:"ch"`
+    }
+    err = flags.FlagFromStruct(&bad_struct{})
+    if !errors.As(err, &e) {
+        t.Errorf("expected an *UnsupportedTypeError, got %T: %v", err, err)
+    }
+}
+
+func TestNumericErrorCauses(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+
+    var (
+        n int
+        n8 int8
+        u uint64
+        f float64
+        f32 float32
+    )
+    flags.Flag(&n, "n", "An int")
+    flags.Flag(&n8, "n8", "An int8")
+    flags.Flag(&u, "u", "A uint64")
+    flags.Flag(&f, "f", "A float64")
+    flags.Flag(&f32, "f32", "A float32")
+
+    tests := []struct {
+        args []string
+        cause error
+    }{
+        {[]string{"-n=1e30"}, strconv.ErrSyntax},
+        {[]string{"-n=99999999999999999999"}, strconv.ErrRange},
+        {[]string{"-n8=300"}, strconv.ErrRange},
+        {[]string{"-u=-1"}, strconv.ErrSyntax},
+        {[]string{"-f=x"}, strconv.ErrSyntax},
+        {[]string{"-f32=x"}, strconv.ErrSyntax},
+    }
+
+    for _, test := range tests {
+        err := flags.Parse(test.args)
+        if !errors.Is(err, test.cause) {
+            t.Errorf("%q: expected an error wrapping %v, got %v", test.args,
+                test.cause, err)
+        }
+
+        var num_err *strconv.NumError
+        if !errors.As(err, &num_err) {
+            t.Errorf("%q: expected a *strconv.NumError, got %v", test.args,
+                err)
+        }
+    }
+}
@@ -46,11 +46,12 @@
 // parameters are specified using struct tags strings, using the tag name
 // `flagutil`. Elements in the tag should be comma-delimited. The first value
 // is the flag name. Remaining parameters must be of the form name='value',
-// where supported names are "del" (optional delimiter for multi-valued
-// flags), and "usage" (the usage string for the flag). In order for a struct
-// field to be used as a flag, the field name must start with an uppercase
-// letter (so that the field is exported), and the name parameter must be
-// specified. The delimiter and parameters are optional.
+// where supported names include "del" (optional delimiter for multi-valued
+// flags), and "usage" (the usage string for the flag). See
+// `FlagFromStruct()` for the full list. In order for a struct field to be
+// used as a flag, the field name must start with an uppercase letter (so
+// that the field is exported), and the name parameter must be specified. The
+// delimiter and parameters are optional.
 //
 // The following specifies a slice of IP addresses as strings. IP addresses
 // can be repeated as separate command-line arguments, each preceded by the
@@ -69,10 +70,16 @@
 //   data := new(MyFlags)
 //   flagutil.FlagFromStruct(data)
 //
+// By default, flags are parsed using the syntax of the flag module. Use
+// `FlagSet.SetSyntax(GNUSyntax)` to accept GNU-style flags instead, e.g.,
+// "--verbose", "--output=file", or "-vx" (combined one-character flags).
+//
 // The default set of command-line flags is controlled by top-level functions.
 // The FlagSet type allows one to define independent sets of flags, such as to
 // implement subcommands in a command-line interface. The methods of FlagSet
 // are analogous to the top-level functions for the command-line flag set.
+// The Command type builds on FlagSet to provide a tree of subcommands, each
+// with its own flags, e.g., "tool -v serve -port 8080".
 package flagutil
 
 import (
@@ -82,9 +89,10 @@ import (
     // log "github.com/cuberat/go-log"
     "os"
     "reflect"
-    // "strconv"
+    "strconv"
     "strings"
-    textparser "github.com/cuberat/go-textparser"
+    "time"
+    "unicode/utf8"
     "unicode"
 )
 
@@ -96,11 +104,36 @@ const (
     PanicOnError ErrorHandling = ErrorHandling(flag.PanicOnError)
 )
 
+// Options for a flag, beyond its name and usage string. These are set from
+// the arguments to `FlagSep()` or from the struct tag in `FlagFromStruct()`.
+type flag_options struct {
+    delimiter string
+    layout string
+    kv_separator string
+    error_on_dup bool
+    env string
+    short string
+    required bool
+    choices []string
+    ignore_case bool
+    constraints [][2]string
+    min_count int
+    group string
+    exclusive bool
+    at_least_one bool
+    requires []string
+    slice_policy SlicePolicy
+    split SplitOptions
+}
+
 // Specs for each flag
 type flag_spec struct {
+    name string
+    opts *flag_options
     val_ptr interface{}
     arg interface{}
     set_func func()
+    validators []func(value interface{}) error
 }
 
 // A FlagSet represents a set of defined flags.
@@ -114,7 +147,29 @@ type FlagSet struct {
     Usage func()
 
     special_flags []*flag_spec
+    specs map[string]*flag_spec
+    env_prefix string
+    config_file string
+    config_flag string
+    config_format ConfigFormat
+    parse_funcs []func()
+    shorts map[string]string
+    syntax Syntax
+    interspersed bool
+    syntax_set bool // SetSyntax() was called.
+    interspersed_set bool // SetInterspersed() was called.
+    has_commands bool // The FlagSet belongs to a Command with children.
+    persistent map[string]bool // Flags shared from persistent flag sets.
+    inherited map[string]bool // Persistent flags set by an ancestor command.
+    selects_command func(args []string) bool // Whether args name a child.
+    groups []*flag_group
+    struct_validators []validator
+    positionals []*positional
+    subcommands []*subcommand
+    selected *subcommand
     name string
+    parsed bool
+    args []string
     error_handling ErrorHandling
     flag_flagset *flag.FlagSet
     output io.Writer
@@ -124,47 +179,166 @@ type FlagSet struct {
 // property. If the name is not empty, it will be printed in the default usage
 // message and in error messages.
 func NewFlagSet(name string, error_handling ErrorHandling) *FlagSet {
+    // Command-line arguments are parsed by flagutil itself (see
+    // `parse_args()`), so errors are handled in one place (see
+    // `handle_error()`). The underlying flag.FlagSet never handles errors.
     flagset := &FlagSet{
         name: name,
         error_handling: error_handling,
-        flag_flagset: flag.NewFlagSet(name, flag.ErrorHandling(error_handling)),
+        flag_flagset: flag.NewFlagSet(name, flag.ContinueOnError),
         output: os.Stderr,
+        specs: make(map[string]*flag_spec),
+        shorts: make(map[string]string),
     }
 
     flagset.Usage = func() {
         fmt.Fprintf(flagset.Output(), "Usage of %s:\n", os.Args[0])
         flagset.PrintDefaults()
     }
+    flagset.flag_flagset.Usage = flagset.usage
 
     return flagset
 }
 
 // PrintDefaults prints, to standard error unless configured otherwise, the
-// default values of all defined command-line flags in the set. See the
-// documentation for the global function PrintDefaults for more information.
+// default values of all defined command-line flags in the set. The format is
+// the same as for the flag module, with additional information, such as the
+// environment variable for the flag, shown after the default value.
 func (fs *FlagSet) PrintDefaults() {
-    fs.flag_flagset.PrintDefaults()
+    fs.flag_flagset.VisitAll(func(f *flag.Flag) {
+        b := new(strings.Builder)
+        b.WriteString("  ")
+        b.WriteString(fs.flag_display_name(f.Name))
+        name, usage := flag.UnquoteUsage(unwrap_flag(f))
+        if len(name) > 0 {
+            b.WriteString(" ")
+            b.WriteString(name)
+        }
+
+        // As in the flag module, usage for single-letter boolean flags goes
+        // on the same line.
+        if b.Len() <= 4 {
+            b.WriteString("\t")
+        } else {
+            b.WriteString("\n    \t")
+        }
+        b.WriteString(strings.ReplaceAll(usage, "\n", "\n    \t"))
+
+        if !is_zero_value(f, f.DefValue) {
+            if is_string_value(f) {
+                fmt.Fprintf(b, " (default %q)", f.DefValue)
+            } else {
+                fmt.Fprintf(b, " (default %v)", f.DefValue)
+            }
+        }
+
+        for _, note := range fs.flag_notes(f) {
+            fmt.Fprintf(b, " (%s)", note)
+        }
+
+        fmt.Fprint(fs.Output(), b.String(), "\n")
+    })
+
+    fs.print_positionals()
+    fs.print_subcommands()
+}
+
+// Returns the flag name as shown by `PrintDefaults()`, e.g., "-name", or
+// "-n, --name" for a flag with a one-character alias in `GNUSyntax`.
+func (fs *FlagSet) flag_display_name(name string) string {
+    dashes := "-"
+    if fs.syntax == GNUSyntax && utf8.RuneCountInString(name) > 1 {
+        dashes = "--"
+    }
+    if short := fs.short_name(name); short != "" {
+        return "-" + short + ", " + dashes + name
+    }
+
+    return dashes + name
+}
+
+// Returns additional information about a flag to show in `PrintDefaults()`.
+func (fs *FlagSet) flag_notes(f *flag.Flag) []string {
+    notes := []string{}
+    if env_var := fs.env_var(f.Name); env_var != "" {
+        notes = append(notes, "env: " + env_var)
+    }
+    spec, ok := fs.specs[f.Name]
+    if ok && len(spec.opts.choices) > 0 {
+        notes = append(notes, "choices: " +
+            strings.Join(spec.opts.choices, "|"))
+    }
+    if ok && spec.opts.required {
+        notes = append(notes, "required")
+    }
+    notes = append(notes, fs.group_notes(f.Name)...)
+
+    return notes
+}
+
+// Reports whether `value` is the string representation of the zero value of
+// the flag's type, in which case it is not shown as a default.
+func is_zero_value(f *flag.Flag, value string) (is_zero bool) {
+    // Some flag.Value implementations panic when String() is called on a
+    // zero value. Don't show a default for those.
+    defer func() {
+        if r := recover(); r != nil {
+            is_zero = true
+        }
+    }()
+
+    typ := reflect.TypeOf(unwrap_value(f.Value))
+    var z reflect.Value
+    if typ.Kind() == reflect.Ptr {
+        z = reflect.New(typ.Elem())
+    } else {
+        z = reflect.Zero(typ)
+    }
+
+    return value == z.Interface().(flag.Value).String()
+}
+
+// Reports whether the flag holds a string, so its default should be quoted.
+func is_string_value(f *flag.Flag) bool {
+    getter, ok := f.Value.(flag.Getter)
+    if !ok {
+        return false
+    }
+    _, ok = getter.Get().(string)
+
+    return ok
 }
 
 // Returns the non-flag arguments (command-line arguments left over after
 // parsing the flags).
 func (fs *FlagSet) Args() []string {
-    return fs.flag_flagset.Args()
+    return fs.args
 }
 
 // Returns the i'th argument. Arg(0) is the first remaining argument after
 // flags have been processed. Arg returns an empty string if the requested
 // element does not exist.
 func (fs *FlagSet) Arg(i int) string {
-    return fs.flag_flagset.Arg(i)
+    if i < 0 || i >= len(fs.args) {
+        return ""
+    }
+    return fs.args[i]
 }
 
 // Returns the destination for usage and error messages. os.Stderr is returned
 // if output was not set or was set to nil.
 func (fs *FlagSet) Output() io.Writer {
+    if fs.output == nil {
+        return os.Stderr
+    }
     return fs.output
 }
 
+// Returns the error handling behavior of the flag set.
+func (fs *FlagSet) ErrorHandling() ErrorHandling {
+    return fs.error_handling
+}
+
 // Sets the destination for usage and error messages. If output is nil,
 // os.Stderr is used.
 func (fs *FlagSet) SetOutput(w io.Writer) {
@@ -176,109 +350,114 @@ func (fs *FlagSet) SetOutput(w io.Writer) {
 // the command name. Must be called after all flags in the FlagSet are defined
 // and before flags are accessed by the program. The return value will be
 // ErrHelp if -help or -h were set but not defined.
+//
+// After the command line, flags that were not set are set from the
+// environment (see `SetEnvPrefix()`), then from the config file, if any (see
+// `SetConfigFile()` and `ConfigFlag()`).
+//
+// Any other error is returned as a `*ParseError` wrapping one of
+// `*UnknownFlagError`, `*MissingValueError`, `*InvalidValueError`,
+// `*FlagSyntaxError`, `*ConfigError`, `*ArgumentError`, or `*CommandError`.
+// Slice flags are only updated if parsing succeeds. If the FlagSet was
+// created with ExitOnError or PanicOnError, Parse exits (with status 0 for
+// ErrHelp, 2 otherwise) or panics instead of returning the error.
+//
+// If subcommands were declared (see `FlagFromStruct()`), the first remaining
+// argument selects the subcommand, and the arguments after it are parsed by
+// the subcommand's FlagSet. See `Subcommand()`.
 func (fs *FlagSet) Parse(args []string) error {
-    err := fs.flag_flagset.Parse(args)
+    if err := fs.parse(args); err != nil {
+        return fs.handle_error(err)
+    }
+
+    return nil
+}
+
+// Does the work of `Parse()`, except for handling errors. Errors are
+// reported to the output, along with the usage message, before being
+// returned.
+func (fs *FlagSet) parse(args []string) error {
+    fs.parsed = true
+    remaining, err := fs.parse_args(args)
+
+    // The flags have already been set, so the underlying FlagSet only needs
+    // the remaining arguments, after "--", to keep its `Parsed()` and
+    // `Args()` in sync for callers of `GetFlagSet()`.
+    fs.flag_flagset.Parse(append([]string{"--"}, remaining...))
+
+    if err == nil {
+        err = fs.apply_env()
+    }
+    if err == nil {
+        err = fs.apply_config()
+    }
     if err != nil {
-        return nil
+        return fs.report_error(err)
     }
+    fs.args = remaining
 
     for _, f := range fs.special_flags {
         if f.set_func != nil {
             f.set_func()
         }
     }
-
-    return nil
-}
-
-type tag_data struct {
-    flag_name string
-    delimiter string
-    usage_string string
-}
-
-func parse_tag(tag_str string) *tag_data {
-    if tag_str == "" {
-        return nil
+    for _, f := range fs.parse_funcs {
+        f()
     }
 
-    fields := make(map[string]string, 2)
+    if err := fs.validate(); err != nil {
+        return fs.report_error(err)
+    }
 
-    p := textparser.NewScannerString(tag_str)
-    field_idx := 0
-    field_name := ""
-    expecting_name := true
-    expecting_value := false
+    if err := fs.apply_positionals(); err != nil {
+        return fs.report_error(err)
+    }
 
-    for p.Scan() {
-        if err := p.Err(); err != nil {
-            return nil
+    if len(fs.subcommands) > 0 {
+        if err := fs.run_subcommand(); err != nil {
+            return err
         }
-        token := p.Token()
-        token_type := token.Type
-        token_text := token.Text
+    }
 
-        if field_idx == 0 {
-            // The first token should be the field name, by itself, as either
-            // an identifier or a quoted string.
-            if token_type != textparser.TokenTypeIdent &&
-                token_type != textparser.TokenTypeString {
-                // FIXME: return an error
-                return nil
-            }
+    // After the subcommand, so that its fields are set, too.
+    if err := fs.validate_structs(); err != nil {
+        return fs.report_error(err)
+    }
 
-            fields["name"] = token_text
-            field_idx++
+    return nil
+}
 
-            continue
-        }
+// Prints `err` (unless it is ErrHelp) and the usage message, and returns
+// the error wrapped in a `*ParseError`.
+func (fs *FlagSet) report_error(err error) error {
+    if err != ErrHelp {
+        fmt.Fprintln(fs.Output(), err)
+        err = &ParseError{FlagSet: fs.name, Err: err}
+    }
+    fs.usage()
 
-        switch token_type {
-        case textparser.TokenTypeSymbol:
-            switch token_text {
-            case ",":
-                field_idx++
-                expecting_name = true
-            case "=":
-                if field_name == "" {
-                    // FIXME: return an error
-                    return nil
-                }
-                expecting_value = true
-            default:
-                // ignore for now
-            }
-        case textparser.TokenTypeIdent:
-            fallthrough
-        case textparser.TokenTypeString:
-            if expecting_name {
-                field_name = token_text
-                expecting_name = false
-                continue
-            }
-            if expecting_value {
-                if field_name == "" {
-                    // FIXME: return an error
-                    return nil
-                }
-                if token_type == textparser.TokenTypeString {
-                    token_text = token_text[1:len(token_text) - 1]
-                }
-                fields[field_name] = token_text
-                expecting_value = false
-                field_name = ""
-                continue
-            }
-        }
+    return err
+}
+
+func (fs *FlagSet) usage() {
+    if fs.Usage != nil {
+        fs.Usage()
     }
+}
 
-    tag_info := &tag_data{
-        flag_name: fields["name"],
-        delimiter: fields["del"],
-        usage_string: fields["usage"],
+// Applies the ErrorHandling policy of the FlagSet to `err`.
+func (fs *FlagSet) handle_error(err error) error {
+    switch fs.error_handling {
+    case ExitOnError:
+        if err == ErrHelp {
+            os.Exit(0)
+        }
+        os.Exit(2)
+    case PanicOnError:
+        panic(err)
     }
 
-    return tag_info
+    return err
 }
 
 // Like `Flag()`, except that `store` must be a pointer to a struct. Exported
@@ -297,7 +476,122 @@ func parse_tag(tag_str string) *tag_data {
 // name as appears on the command line). The delimiter ("del" field) is
 // optional and is used to split arguments into a slice, where appropriate.
 // The usage string ("usage"), if provided, will be used as in the usage
-// message.
+// message. The name may not be empty, start with "-", or contain "=". A field
+// tagged `flagutil:"-"` is skipped, as if it had no tag.
+//
+// Supported keys:
+//  del      - Delimiter used to split an argument into multiple values for
+//             slice and map flags.
+//  split    - How arguments are split on the delimiter: any of "csv" (honor
+//             quotes and backslash escapes), "trim" (trim whitespace), and
+//             "skipempty" or "noempty" (skip or reject empty elements),
+//             separated by "|", e.g., split='csv|trim'. See `SetSplit()`.
+//  usage    - The usage string.
+//  layout   - For `time.Time` and `*time.Time` fields (and slices of them),
+//             the layout passed to `time.Parse()`. The default is
+//             `time.RFC3339`.
+//  kvsep    - For map fields, the separator between a key and its value. The
+//             default is "=".
+//  dupkeys  - For map fields, what to do when a key is repeated: "last" (the
+//             default) keeps the last value, "error" rejects the argument.
+//  env      - Environment variable used to set the flag if it is not given on
+//             the command line. See `SetEnvPrefix()`.
+//  required - Takes no value. The flag must be set, on the command line,
+//             from the environment, or from a config file. See
+//             `MarkRequired()`.
+//  choices  - For string and []string fields, the allowed values,
+//             separated by "|", e.g., 'json|text'. See `SetChoices()`.
+//  nocase   - Takes no value. Values are matched against "choices"
+//             ignoring case.
+//  min, max - For numeric fields (and slices of them), the smallest and
+//             largest allowed values, e.g., min=1. See `SetConstraint()`.
+//  minlen, maxlen - For string fields (and slices of them), the allowed
+//             length, in characters.
+//  pattern  - For string fields (and slices of them), a regular expression
+//             that values must match in full.
+//  mincount, maxcount - For slice fields, the allowed number of values.
+//  group    - The name of a group of flags, used with "exclusive" and
+//             "atleastone". See `MutuallyExclusive()`.
+//  exclusive, atleastone - Take no value. At most one, or at least one,
+//             flag in the group may be set.
+//  requires - Names of flags, separated by "|", that must be set if this
+//             flag is set. See `DependsOn()`.
+//  default  - The default value, parsed like a command-line argument, e.g.,
+//             default='1m' for a `time.Duration`, or default='a,b' for a
+//             []string with del=','. This replaces any value the field
+//             already has. Not supported for positional arguments,
+//             subcommands, or nested structs.
+//  slice    - For slice fields, how values given on the command line are
+//             combined with the default: "replace" (the default) or
+//             "append". See `SetSlicePolicy()`.
+//  short    - A one-character alias for the flag, e.g., "v". See
+//             `SetSyntax()`.
+//  prefix   - For nested struct fields, the prefix for the names of the
+//             nested flags. The default is the flag name followed by ".".
+//  pos      - Makes the field a positional argument, rather than a flag, at
+//             the specified index (starting at 0) in `Args()`. See below.
+//  cmd      - Takes no value. The field, a struct or pointer to a struct, is a
+//             subcommand rather than a flag. See below.
+//
+// A field that is a struct (or pointer to a struct) that doesn't parse
+// itself (see `Flag()`) holds nested flags, which are named using a prefix:
+//
+//  type DBConfig struct {
+//      Host string `flagutil:"host,usage='Database host'"`
+//      Port int `flagutil:"port,usage='Database port'"`
+//  }
+//
+//  type Flags struct {
+//      DB DBConfig `flagutil:"db,usage='Database settings'"`
+//      Cache *DBConfig `flagutil:"cache,prefix='cache-'"`
+//  }
+//
+// This defines the flags -db.host, -db.port, -cache-host, and -cache-port.
+// A nil pointer field is only allocated if one of its flags is set.
+// Embedded structs without a tag are flattened, i.e., their flags are
+// defined without a prefix.
+//
+// Positional arguments are converted like flags of the same type, and are
+// set after flags are parsed. If the last one is a slice, e.g., []string, it
+// takes any remaining arguments. Otherwise, every positional argument is
+// required, and extra arguments are an error. Arity and conversion errors
+// are returned from `Parse()` as a `*ParseError` wrapping an
+// `*ArgumentError`. `Args()` still returns all the non-flag arguments.
+//
+//  type CopyFlags struct {
+//      Force bool `flagutil:"f,usage='Overwrite files'"`
+//      Dest string `flagutil:"dest,pos=0,usage='Destination directory'"`
+//      Files []string `flagutil:"files,pos=1,usage='Files to copy'"`
+//  }
+//
+// Subcommands allow one struct to describe a whole command-line interface:
+//
+//  type ServeFlags struct {
+//      Port int `flagutil:"port,usage='Port to listen on'"`
+//  }
+//
+//  type Flags struct {
+//      Verbose bool `flagutil:"v,usage='Verbose output'"`
+//      Serve *ServeFlags `flagutil:"serve,cmd,usage='Run the server'"`
+//  }
+//
+// Given "-v serve -port 8080", `Parse()` sets `Verbose`, then parses
+// "-port 8080" into `Serve`. A nil pointer field is only allocated if its
+// subcommand is selected, so the caller can check which subcommand was used
+// by comparing the fields against nil, or by calling `Selected()`.
+// Subcommand structs may declare subcommands of their own.
+//
+// If `store` has a `Validate() error` method, it is called at the end of
+// `Parse()`, after all flags and positional arguments have been set
+// (including those of the selected subcommand, if any), to check rules
+// involving several fields. An error it returns is handled like any other
+// error from `Parse()`, i.e., it is reported along with the usage message,
+// and returned wrapped in a `*ParseError` (or causes an exit or a panic,
+// depending on the FlagSet's ErrorHandling).
+//
+// A malformed tag, or one using an unknown key, results in a `*TagError`
+// that reports the field and the column in the tag where the problem was
+// found.
 func (fs *FlagSet) FlagFromStruct(store interface{}) error {
     ptr_value := reflect.ValueOf(store)
     if ptr_value.Kind() != reflect.Ptr {
@@ -310,41 +604,270 @@ func (fs *FlagSet) FlagFromStruct(store interface{}) error {
             data.Kind().String())
     }
 
+    if _, err := fs.flags_from_struct(data, ""); err != nil {
+        return err
+    }
+
+    if err := fs.check_dependencies(); err != nil {
+        return err
+    }
+    if err := fs.check_positionals(); err != nil {
+        return err
+    }
+
+    if v, ok := store.(validator); ok {
+        fs.struct_validators = append(fs.struct_validators, v)
+    }
+
+    return nil
+}
+
+// Defines flags for the fields of the struct `data`, prefixing each flag
+// name with `prefix`. Returns the names of the flags defined.
+func (fs *FlagSet) flags_from_struct(
+    data reflect.Value,
+    prefix string,
+) ([]string, error) {
+    names := []string{}
     data_type := data.Type()
     num_fields := data_type.NumField()
     for i := 0; i < num_fields; i++ {
         type_field := data_type.Field(i)
         field_name := type_field.Name
-        if !first_char_is_upper(field_name) {
+        data_field := data.Field(i)
+
+        // Unexported fields are skipped without looking at their tags,
+        // except embedded structs, whose exported fields are promoted.
+        if !type_field.Anonymous && !first_char_is_upper(field_name) {
             continue
         }
 
         tag := type_field.Tag
         my_tag_str := tag.Get("flagutil")
-        tag_data := parse_tag(my_tag_str)
-        if tag_data == nil || tag_data.flag_name == "" {
+        if my_tag_str == "-" {
+            continue
+        }
+        tag_data, err := parse_tag(my_tag_str)
+        if err != nil {
+            tag_err := err.(*TagError)
+            tag_err.Struct = data_type.Name()
+            tag_err.Field = field_name
+            return nil, tag_err
+        }
+
+        // Untagged embedded structs are flattened, even if the embedded
+        // type is unexported, since their exported fields are promoted.
+        if type_field.Anonymous && tag_data == nil &&
+            is_nested_struct(type_field.Type) {
+            if data_field.Kind() == reflect.Ptr && !data_field.CanSet() {
+                continue
+            }
+            nested, err := fs.nested_struct(data_field, prefix)
+            if err != nil {
+                return nil, err
+            }
+            names = append(names, nested...)
             continue
         }
 
+        if !first_char_is_upper(field_name) || tag_data == nil {
+            continue
+        }
 
-        param_name := tag_data.flag_name
+        param_name := prefix + tag_data.flag_name
         usage_str := tag_data.usage_string
-        delimiter := tag_data.delimiter
 
-        data_field := data.Field(i)
+        // Positional arguments are required unless variadic, and
+        // subcommands and nested structs have no value of their own.
+        if tag_data.has_default && (tag_data.command ||
+            tag_data.position >= 0 || is_nested_struct(type_field.Type)) {
+            return nil, &TagError{
+                Struct: data_type.Name(),
+                Field: field_name,
+                Tag: my_tag_str,
+                Err: fmt.Errorf(`key "default" is not supported for ` +
+                    "positional arguments, subcommands, or nested structs"),
+            }
+        }
+
+        if tag_data.command {
+            err = fs.add_subcommand(data_field, param_name, usage_str)
+            if err != nil {
+                return nil, fmt.Errorf("couldn't set up field %q for %s: %w",
+                    field_name, data_type.Name(), err)
+            }
+            continue
+        }
+
+        if tag_data.position >= 0 {
+            err = fs.add_positional(data_field, tag_data.flag_name, usage_str,
+                tag_data.position)
+            if err != nil {
+                return nil, fmt.Errorf("couldn't set up field %q for %s: %w",
+                    field_name, data_type.Name(), err)
+            }
+            continue
+        }
+
+        if is_nested_struct(type_field.Type) {
+            nested_prefix := param_name + "."
+            if tag_data.prefix != "" {
+                nested_prefix = prefix + tag_data.prefix
+            }
+            nested, err := fs.nested_struct(data_field, nested_prefix)
+            if err != nil {
+                return nil, err
+            }
+            names = append(names, nested...)
+            continue
+        }
+
+        opts := &flag_options{
+            delimiter: tag_data.delimiter,
+            layout: tag_data.layout,
+            kv_separator: tag_data.kv_separator,
+            error_on_dup: tag_data.dup_keys == "error",
+            env: tag_data.env,
+            short: tag_data.short,
+            required: tag_data.required,
+            choices: tag_data.choices,
+            ignore_case: tag_data.ignore_case,
+            constraints: tag_data.constraints,
+            exclusive: tag_data.exclusive,
+            at_least_one: tag_data.at_least_one,
+            slice_policy: tag_data.slice_policy,
+            split: tag_data.split,
+        }
+
+        // Group and flag names are relative to the struct.
+        if tag_data.group != "" {
+            opts.group = prefix + tag_data.group
+        }
+        for _, required := range tag_data.requires {
+            opts.requires = append(opts.requires, prefix + required)
+        }
+
         data_field_ptr := data_field.Addr()
-        err := fs.FlagSep(data_field_ptr.Interface(), param_name, usage_str,
-            delimiter)
+        if tag_data.has_default {
+            err = set_default(data_field_ptr.Interface(), param_name,
+                tag_data.default_value, opts)
+            if err != nil {
+                return nil, fmt.Errorf("couldn't set up field %q for %s: %w",
+                    field_name, data_type.Name(), err)
+            }
+        }
+
+        err = fs.add_flag(data_field_ptr.Interface(), param_name, usage_str,
+            opts)
         if err != nil {
-            return fmt.Errorf("couldn't set up field %q for %s: %s",
+            return nil, fmt.Errorf("couldn't set up field %q for %s: %w",
                 field_name, data_type.Name(), err)
         }
+        names = append(names, param_name)
+
+        // Slice and map flags don't show the values they start with.
+        if tag_data.has_default && tag_data.default_value != "" {
+            f := fs.flag_flagset.Lookup(param_name)
+            if spec := fs.specs[param_name]; spec.set_func != nil {
+                f.DefValue = tag_data.default_value
+            }
+        }
+    }
+
+    return names, nil
+}
+
+// Defines flags for a nested struct field, which is either a struct or a
+// pointer to one. A nil pointer is only set, to a newly allocated struct, if
+// one of its flags is set while parsing.
+func (fs *FlagSet) nested_struct(
+    field reflect.Value,
+    prefix string,
+) ([]string, error) {
+    if field.Kind() == reflect.Struct {
+        return fs.flags_from_struct(field, prefix)
+    }
+    if !field.IsNil() {
+        return fs.flags_from_struct(field.Elem(), prefix)
+    }
+
+    store := reflect.New(field.Type().Elem())
+    names, err := fs.flags_from_struct(store.Elem(), prefix)
+    if err != nil {
+        return nil, err
+    }
+
+    fs.parse_funcs = append(fs.parse_funcs, func() {
+        set := fs.set_flags()
+        for _, name := range names {
+            if set[name] {
+                field.Set(store)
+                return
+            }
+        }
+    })
 
+    return names, nil
+}
+
+// Sets the variable `store` points to from `value`, as if `value` were given
+// on the command line for a flag defined with `opts`, e.g., splitting it on
+// the delimiter for a slice. The value must satisfy the flag's choices and
+// constraints.
+func set_default(
+    store interface{},
+    name, value string,
+    opts *flag_options,
+) error {
+    // Only the checks on the value itself apply; relationships with other
+    // flags are checked when parsing.
+    tmp_opts := *opts
+    tmp_opts.short = ""
+    tmp_opts.group = ""
+    tmp_opts.exclusive = false
+    tmp_opts.at_least_one = false
+    tmp_opts.slice_policy = SliceReplace
+
+    tmp := NewFlagSet(name, ContinueOnError)
+    if err := tmp.add_flag(store, name, "", &tmp_opts); err != nil {
+        return err
+    }
+    if err := tmp.flag_flagset.Set(name, value); err != nil {
+        return &InvalidValueError{FlagError{Flag: name, Value: value, Pos: -1,
+            Source: "default", Err: err}}
+    }
+    for _, f := range tmp.special_flags {
+        if f.set_func != nil {
+            f.set_func()
+        }
+    }
+
+    if tmp_opts.min_count > 0 &&
+        reflect.ValueOf(store).Elem().Len() < tmp_opts.min_count {
+        return &InvalidValueError{FlagError{Flag: name, Value: value, Pos: -1,
+            Source: "default", Err: &ConstraintError{
+                Constraint: "mincount",
+                Limit: strconv.Itoa(tmp_opts.min_count),
+            }}}
     }
 
     return nil
 }
 
+// Reports whether a field of type `t` holds nested flags, i.e., it is a
+// struct, or a pointer to one, that can't be parsed from a single argument.
+func is_nested_struct(t reflect.Type) bool {
+    elem := t
+    if elem.Kind() == reflect.Ptr {
+        elem = elem.Elem()
+    }
+    if elem.Kind() != reflect.Struct {
+        return false
+    }
+
+    return get_parse_func(t) == nil
+}
+
 func first_char_is_upper(s string) bool {
     r := strings.NewReader(s)
     ch, _, err := r.ReadRune()
@@ -360,6 +883,23 @@ func first_char_is_upper(s string) bool {
 // type of the flag is determined from the underlying type of the variable
 // pointed to by `store`.
 //
+// In addition to the types supported by the flag module, `store` may point
+// to a `time.Time`, which is parsed using the `time.RFC3339` layout, or to
+// any other numeric type (e.g., `int8`, `uint16`, `float32`, `complex128`),
+// including named types such as `type Port uint16`. Numeric values are
+// checked against the range of the type.
+//
+// If `store` implements `flag.Value`, it is used as-is. Otherwise, if a
+// pointer to the type of the variable implements `flag.Value`,
+// `encoding.TextUnmarshaler`, or `encoding.BinaryUnmarshaler` (checked in
+// that order), the argument is parsed using the corresponding method. This
+// allows types such as `net.IP`, `*url.URL`, or `big.Int` to be used
+// directly, as well as slices of them. Pointer fields (e.g., `*url.URL`) are
+// allocated as needed.
+//
+// Network addresses are supported via `net.IP`, `net.IPNet` (in CIDR
+// notation, as either a value or a pointer), `netip.Addr`, `netip.Prefix`,
+// `netip.AddrPort`, and `HostPort` (a validated "host:port" pair).
 //
 // If `store` is a pointer to a supported slice type, the same flag will be
 // accepted multiple times on the command line, with each value stored in the
@@ -370,6 +910,14 @@ func first_char_is_upper(s string) bool {
 // - []uint64
 // - []float64
 // - []string
+// - []time.Duration
+// - []time.Time
+// - slices of any other numeric, bool, or string kind
+// - slices of types that parse themselves, as described above
+//
+// Similarly, if `store` is a pointer to a map, e.g., `map[string]string` or
+// `map[string]int`, the flag may be repeated, with each argument of the form
+// "key=value". Keys and values may be of any supported scalar type.
 //
 // See `FlagSep()` for supporting multiple values specified in a single
 // command line argument.
@@ -381,23 +929,157 @@ func (fs *FlagSet) Flag(store interface{}, name, usage string) error {
 // multiple when `store` is a slice. When a delimiter is specified, the
 // arguments may be specified as both multiple command-line arguments and
 // single command-line arguments with multiple values separated by the
-// specified delimiter.
+// specified delimiter. Use `SetSplit()` to allow quoted values that contain
+// the delimiter.
+//
+// By default, values given for a slice replace the slice's initial value.
+// Use `SetSlicePolicy()` after defining the flag to append to it instead.
+// An empty argument (e.g., "-tag=") clears the slice.
 func (fs *FlagSet) FlagSep(store interface{}, name, usage, del string) error {
+    return fs.add_flag(store, name, usage, &flag_options{delimiter: del})
+}
+
+// Sets how the values given for the slice flag `name` are combined with the
+// value the bound slice starts with (its default): `SliceReplace` (the
+// default) or `SliceAppend`. This is equivalent to the "slice" key in a
+// struct tag.
+//
+// With either policy, an empty argument, e.g., "-tag=", is a reset token: it
+// discards the default and any values given before it. So "-tag=" alone sets
+// the slice to an empty slice, and "-tag= -tag x" sets it to just "x", even
+// with `SliceAppend`. The "mincount" and "maxcount" constraints (see
+// `SetConstraint()`) apply to the resulting slice, so a default kept under
+// `SliceAppend` counts toward them, and values discarded by a reset token
+// do not.
+func (fs *FlagSet) SetSlicePolicy(name string, policy SlicePolicy) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    if !is_slice_flag(spec) {
+        return fmt.Errorf("flag -%s is not a slice flag", name)
+    }
+    spec.opts.slice_policy = policy
+
+    return nil
+}
+
+// Sets how arguments for the multi-valued (slice or map) flag `name` are
+// split on its delimiter, e.g., to allow quoted values that contain the
+// delimiter. This is equivalent to the "split" key in a struct tag. See
+// `SplitOptions`.
+func (fs *FlagSet) SetSplit(name string, opts SplitOptions) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+
+    switch arg := spec.arg.(type) {
+    case *MultiArg[reflect.Value]:
+        arg.Split = opts
+    case *MultiArgMap:
+        arg.Split = opts
+    case *map_arg_value:
+        arg.split = opts
+    default:
+        return fmt.Errorf("flag -%s is not a multi-valued flag", name)
+    }
+    spec.opts.split = opts
+
+    return nil
+}
+
+// Like `Flag()`, except also define a one-character alias for the flag,
+// e.g., "v" for "verbose". See `SetSyntax()`.
+func (fs *FlagSet) FlagShort(
+    store interface{},
+    name, usage, short string,
+) error {
+    return fs.add_flag(store, name, usage, &flag_options{short: short})
+}
+
+func (fs *FlagSet) add_flag(
+    store interface{},
+    name, usage string,
+    opts *flag_options,
+) error {
+    if err := fs.check_long(name); err != nil {
+        return err
+    }
+    if opts.short != "" {
+        if err := fs.check_short(name, opts.short); err != nil {
+            return err
+        }
+    }
+
+    if err := fs.define_flag(store, name, usage, opts); err != nil {
+        return err
+    }
+
+    if opts.short != "" {
+        fs.shorts[opts.short] = name
+    }
+
+    if len(opts.choices) > 0 {
+        err := fs.SetChoices(name, opts.choices, opts.ignore_case)
+        if err != nil {
+            return err
+        }
+    }
+
+    for _, c := range opts.constraints {
+        if err := fs.SetConstraint(name, c[0], c[1]); err != nil {
+            return err
+        }
+    }
+
+    if (opts.exclusive || opts.at_least_one) && opts.group == "" {
+        return fmt.Errorf("flag -%s must be in a group to be exclusive or " +
+            "require at least one flag", name)
+    }
+    if opts.group != "" {
+        fs.add_to_group(opts.group, name, opts.exclusive, opts.at_least_one)
+    }
+
+    return nil
+}
+
+func (fs *FlagSet) define_flag(
+    store interface{},
+    name, usage string,
+    opts *flag_options,
+) error {
     if store == nil {
-        return fmt.Errorf("`store` must be a non-nil pointer")
+        return unsupported_type_error(name, nil,
+            fmt.Errorf("`store` must be a non-nil pointer"))
     }
 
     ptr_value := reflect.ValueOf(store)
     kind := ptr_value.Kind()
     if kind != reflect.Ptr {
-        return fmt.Errorf("`store` must be a pointer to a supported type")
+        return unsupported_type_error(name, ptr_value.Type(),
+            fmt.Errorf("`store` must be a pointer to a supported type"))
+    }
+
+    // Types that implement flag.Value are used as-is.
+    if value, ok := store.(flag.Value); ok {
+        fs.flag_flagset.Var(value, name, usage)
+        fs.new_spec(name, opts).val_ptr = store
+        return nil
     }
 
     elem := ptr_value.Elem()
     elem_kind := elem.Kind()
 
-    if elem_kind == reflect.Slice {
-        return fs.set_slice(ptr_value, name, usage, elem, del)
+    // Some slice types, e.g., net.IP, parse themselves from a single
+    // argument.
+    if elem_kind == reflect.Slice &&
+        unmarshaler_parse_func(elem.Type()) == nil {
+        return fs.set_slice(ptr_value, name, usage, elem, opts)
+    }
+
+    if elem_kind == reflect.Map {
+        return fs.set_map(ptr_value, name, usage, elem, opts)
     }
 
     switch v := store.(type) {
@@ -415,14 +1097,58 @@ func (fs *FlagSet) FlagSep(store interface{}, name, usage, del string) error {
         fs.flag_flagset.Float64Var(v, name, *v, usage)
     case *string:
         fs.flag_flagset.StringVar(v, name, *v, usage)
+    case *time.Duration:
+        fs.flag_flagset.DurationVar(v, name, *v, usage)
+    case *time.Time:
+        fs.flag_flagset.Var(new_time_value(v, opts.layout), name, usage)
     default:
-        return fmt.Errorf("Unsuported type %s (%s) for flag %q",
-            kind.String(), v, name)
+        parse := layout_parse_func(elem.Type(), opts.layout)
+        if parse == nil {
+            parse = get_parse_func(elem.Type())
+        }
+        if parse == nil {
+            return unsupported_type_error(name, reflect.TypeOf(v), nil)
+        }
+        fs.flag_flagset.Var(new_reflect_value(ptr_value, parse), name, usage)
     }
 
+    // Arguments for the numeric types handled by the flag module are checked
+    // with the same parse_func as other numeric kinds, so that errors wrap
+    // the same causes, e.g., `strconv.ErrRange`.
+    switch store.(type) {
+    case *int, *int64, *uint, *uint64, *float64:
+        f := fs.flag_flagset.Lookup(name)
+        f.Value = &numeric_value{
+            Value: f.Value,
+            parse: kind_parse_func(elem.Type()),
+        }
+    }
+    fs.new_spec(name, opts).val_ptr = store
+
     return nil
 }
 
+// Records the spec for a newly defined flag.
+func (fs *FlagSet) new_spec(name string, opts *flag_options) *flag_spec {
+    spec := &flag_spec{name: name, opts: opts}
+    fs.specs[name] = spec
+
+    return spec
+}
+
+// Returns the spec for the flag `name`, creating one if the flag was defined
+// via `Var()`. Returns an error if there is no such flag.
+func (fs *FlagSet) lookup_spec(name string) (*flag_spec, error) {
+    if spec, ok := fs.specs[name]; ok {
+        return spec, nil
+    }
+    if fs.flag_flagset.Lookup(name) == nil {
+        return nil, fmt.Errorf("no such flag -%s", name)
+    }
+
+    return fs.new_spec(name, &flag_options{}), nil
+}
+
 // Pass-through to the underlying `flag` object.
 //
 // Var defines a flag with the specified name and usage string. The type and
@@ -431,15 +1157,19 @@ func (fs *FlagSet) FlagSep(store interface{}, name, usage, del string) error {
 // the caller could create a flag that turns a comma-separated string into a
 // slice of strings by giving the slice the methods of `Value`; in particular,
 // Set would decompose the comma-separated string into the slice.
+//
+// Like redefining a flag, using the one-character alias of another flag as
+// the name causes a panic.
 func (f *FlagSet) Var(value flag.Value, name string, usage string) {
+    if err := f.check_long(name); err != nil {
+        panic(err)
+    }
     f.flag_flagset.Var(value, name, usage)
 }
 
-// Pass-through to the underlying `flag` object.
-//
 // Parsed reports whether `f.Parse` has been called.
 func (f *FlagSet) Parsed() bool {
-    return f.flag_flagset.Parsed()
+    return f.parsed
 }
 
 // Pass-through to the underlying `flag` object. Note that the function passed
@@ -469,114 +1199,113 @@ func (fs *FlagSet) set_slice(
     ptr_value reflect.Value,
     name, usage string,
     the_slice reflect.Value,
-    sep string,
+    opts *flag_options,
 ) error {
     slice_type := the_slice.Type().Elem()
-    elem_kind := slice_type.Kind()
+    sep := opts.delimiter
 
-    spec := new(flag_spec)
-    intfc_ptr_value := ptr_value.Interface()
+    spec := &flag_spec{name: name, opts: opts}
+    spec.val_ptr = ptr_value.Interface()
 
-    switch elem_kind {
-    case reflect.Int:
-        int_arg := NewMultiArgInt(sep)
-        fs.flag_flagset.Var(int_arg, name, usage)
-        spec.arg = int_arg
-        int_ptr, ok := intfc_ptr_value.(*[]int)
-        if !ok {
-            return fmt.Errorf("not a *[]int")
-        }
-        spec.val_ptr = int_ptr
-        spec.set_func = func() {
-            if vals := int_arg.GetInts(); len(vals) > 0 {
-                *int_ptr = vals
-            }
-        }
-        fs.special_flags = append(fs.special_flags, spec)
-    case reflect.Int64:
-        int64_arg := NewMultiArgInt64(sep)
-        fs.flag_flagset.Var(int64_arg, name, usage)
-        spec.arg = int64_arg
-        int64_ptr, ok := intfc_ptr_value.(*[]int64)
-        if !ok {
-            return fmt.Errorf("not a *[]int64")
-        }
-        spec.val_ptr = int64_ptr
-        spec.set_func = func() {
-            if vals := int64_arg.GetInt64s(); len(vals) > 0 {
-                *int64_ptr = vals
-            }
-        }
-        fs.special_flags = append(fs.special_flags, spec)
+    // Values are collected as reflect.Values, so that every element type
+    // with a parse_func (e.g., []int8, []net.IP, or a slice of a named type)
+    // is handled the same way.
+    parse := layout_parse_func(slice_type, opts.layout)
+    if parse == nil {
+        parse = slice_parse_func(slice_type)
+    }
+    if parse == nil {
+        return unsupported_type_error(name, ptr_value.Type(), nil)
+    }
+    arg := NewMultiArg[reflect.Value](sep, parse)
+    arg.Split = opts.split
+    spec.arg = arg
 
-    case reflect.Uint:
-        uint_arg := NewMultiArgUint(sep)
-        fs.flag_flagset.Var(uint_arg, name, usage)
-        spec.arg = uint_arg
-        uint_ptr, ok := intfc_ptr_value.(*[]uint)
-        if !ok {
-            return fmt.Errorf("not a *[]uint")
-        }
-        spec.val_ptr = uint_ptr
-        spec.set_func = func() {
-            if vals := uint_arg.GetUints(); len(vals) > 0 {
-                *uint_ptr = vals
-            }
-        }
-        fs.special_flags = append(fs.special_flags, spec)
+    // The values collected so far, as a slice of the bound type.
+    values := func() reflect.Value {
+        vals := reflect.MakeSlice(the_slice.Type(), 0, len(arg.Args))
+        return reflect.Append(vals, arg.Args...)
+    }
+    value := &slice_value{
+        Value: arg,
+        count: func() int { return len(arg.Args) },
+    }
 
-    case reflect.Uint64:
-        uint64_arg := NewMultiArgUint64(sep)
-        fs.flag_flagset.Var(uint64_arg, name, usage)
-        spec.arg = uint64_arg
-        uint64_ptr, ok := intfc_ptr_value.(*[]uint64)
-        if !ok {
-            return fmt.Errorf("not a *[]uint64")
-        }
-        spec.val_ptr = uint64_ptr
-        spec.set_func = func() {
-            if vals := uint64_arg.GetUint64s(); len(vals) > 0 {
-                *uint64_ptr = vals
-            }
-        }
-        fs.special_flags = append(fs.special_flags, spec)
+    // A copy of the default, which `SliceAppend` appends to. The set_func
+    // may run more than once, e.g., for each level of a command tree, so it
+    // must not append to the slice as it is when it runs.
+    default_vals := reflect.AppendSlice(
+        reflect.MakeSlice(the_slice.Type(), 0, the_slice.Len()), the_slice)
+
+    spec.set_func = func() {
+        vals := values()
+        vals = vals.Slice(value.start, vals.Len())
+        bound := ptr_value.Elem()
 
-    case reflect.Float64:
-        float64_arg := NewMultiArgFloat64(sep)
-        fs.flag_flagset.Var(float64_arg, name, usage)
-        spec.arg = float64_arg
-        float64_ptr, ok := intfc_ptr_value.(*[]float64)
-        if !ok {
-            return fmt.Errorf("not a *[]float64")
+        switch {
+        case value.reset && vals.Len() == 0:
+            bound.Set(reflect.MakeSlice(bound.Type(), 0, 0))
+        case vals.Len() == 0:
+            // Keep the default.
+        case spec.opts.slice_policy == SliceAppend && !value.reset:
+            merged := reflect.MakeSlice(bound.Type(), 0,
+                default_vals.Len() + vals.Len())
+            merged = reflect.AppendSlice(merged, default_vals)
+            bound.Set(reflect.AppendSlice(merged, vals))
+        default:
+            bound.Set(vals)
         }
-        spec.val_ptr = float64_ptr
+    }
+
+    fs.flag_flagset.Var(value, name, usage)
+    fs.specs[name] = spec
+    fs.special_flags = append(fs.special_flags, spec)
+
+    return nil
+}
+
+func (fs *FlagSet) set_map(
+    ptr_value reflect.Value,
+    name, usage string,
+    the_map reflect.Value,
+    opts *flag_options,
+) error {
+    spec := &flag_spec{name: name, opts: opts}
+    spec.val_ptr = ptr_value.Interface()
+
+    if map_ptr, ok := spec.val_ptr.(*map[string]string); ok {
+        map_arg := NewMultiArgMap(opts.delimiter, opts.kv_separator)
+        map_arg.ErrorOnDup = opts.error_on_dup
+        map_arg.Split = opts.split
+        spec.arg = map_arg
         spec.set_func = func() {
-            if vals := float64_arg.GetFloat64s(); len(vals) > 0 {
-                *float64_ptr = vals
+            if vals := map_arg.GetMap(); len(vals) > 0 {
+                *map_ptr = vals
             }
         }
-        fs.special_flags = append(fs.special_flags, spec)
-
-    case reflect.String:
-        string_arg := NewMultiArgString(sep)
-        fs.flag_flagset.Var(string_arg, name, usage)
-        spec.arg = string_arg
-        string_ptr, ok := intfc_ptr_value.(*[]string)
-        if !ok {
-            return fmt.Errorf("not a *[]string")
+    } else {
+        map_type := the_map.Type()
+        parse_key := get_parse_func(map_type.Key())
+        parse_val := get_parse_func(map_type.Elem())
+        if parse_key == nil || parse_val == nil {
+            return unsupported_type_error(name, ptr_value.Type(), nil)
         }
-        spec.val_ptr = string_ptr
+
+        map_arg := new_map_arg_value(map_type, opts.delimiter,
+            opts.kv_separator, parse_key, parse_val)
+        map_arg.error_on_dup = opts.error_on_dup
+        map_arg.split = opts.split
+        spec.arg = map_arg
         spec.set_func = func() {
-            if vals := string_arg.GetStrings(); len(vals) > 0 {
-                *string_ptr = vals
+            if map_arg.values.Len() > 0 {
+                ptr_value.Elem().Set(map_arg.values)
             }
         }
-        fs.special_flags = append(fs.special_flags, spec)
-
-    default:
-        return fmt.Errorf("Unsuported slice type %s for flag %q",
-            elem_kind.String(), name)
     }
 
+    fs.flag_flagset.Var(spec.arg.(flag.Value), name, usage)
+    fs.specs[name] = spec
+    fs.special_flags = append(fs.special_flags, spec)
+
     return nil
 }
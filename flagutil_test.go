@@ -1,14 +1,19 @@
 package flagutil_test
 
 import (
+    "errors"
     "flag"
     flagutil "github.com/cuberat/go-flagutil"
     "fmt"
+    "io"
     "os"
+    "os/exec"
     "reflect"
     "sort"
+    "strconv"
     "strings"
     "testing"
+    "time"
 )
 
 func TestMultiArgString(t *testing.T) {
@@ -137,6 +142,62 @@ func TestMultiArgUint(t *testing.T) {
     }
 }
 
+func TestMultiArgGeneric(t *testing.T) {
+    options := flag.NewFlagSet("test", flag.ContinueOnError)
+    options.SetOutput(io.Discard)
+
+    // Custom parse function.
+    upper := flagutil.NewMultiArg(",", func(s string) (string, error) {
+        if s == "" {
+            return "", errors.New("empty name")
+        }
+        return strings.ToUpper(s), nil
+    })
+    options.Var(upper, "name", "Name")
+
+    // Parsed based on the type.
+    levels := flagutil.NewMultiArg[int8](",", nil)
+    options.Var(levels, "level", "Level")
+
+    err := options.Parse([]string{"-name", "a,b", "-level", "-3,7",
+        "-name", "c"})
+    if err != nil {
+        t.Errorf("error parsing options: %s", err)
+        return
+    }
+
+    if expected := []string{"A", "B", "C"};
+        !reflect.DeepEqual(upper.Values(), expected) {
+        t.Errorf("got %+v, expected %+v", upper.Values(), expected)
+    }
+    if expected := []int8{-3, 7};
+        !reflect.DeepEqual(levels.Values(), expected) {
+        t.Errorf("got %+v, expected %+v", levels.Values(), expected)
+    }
+
+    // Nothing is appended if any of the values fail to parse.
+    if err := levels.Set("1,300"); err == nil {
+        t.Errorf("expected an error for an out of range value")
+    }
+    if err := upper.Set("d,"); err == nil {
+        t.Errorf("expected an error for an empty name")
+    }
+    if len(levels.Values()) != 2 || len(upper.Values()) != 3 {
+        t.Errorf("values appended on error: %+v, %+v", levels.Values(),
+            upper.Values())
+    }
+
+    times := flagutil.NewMultiArgTime(",", "2006-01-02")
+    if err := times.Set("2020-01-02,2021-03-04"); err != nil {
+        t.Errorf("error setting times: %s", err)
+        return
+    }
+    if got, expected := times.String(), "[2020-01-02 2021-03-04]";
+        got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
+
 type TstTypesData struct {
     Args []string
     Expected interface{}
@@ -168,6 +229,52 @@ func TestFlagSetTypes(t *testing.T) {
         "bool": &TstTypesData{
             Args: []string{}, Expected: true, Got: ptr_to(false),
         },
+        "int8": &TstTypesData{
+            Args: []string{"-8"}, Expected: int8(-8), Got: ptr_to(int8(0)),
+        },
+        "int16": &TstTypesData{
+            Args: []string{"-16"}, Expected: int16(-16), Got: ptr_to(int16(0)),
+        },
+        "int32": &TstTypesData{
+            Args: []string{"-32"}, Expected: int32(-32), Got: ptr_to(int32(0)),
+        },
+        "uint8": &TstTypesData{
+            Args: []string{"8"}, Expected: uint8(8), Got: ptr_to(uint8(0)),
+        },
+        "uint16": &TstTypesData{
+            Args: []string{"16"}, Expected: uint16(16), Got: ptr_to(uint16(0)),
+        },
+        "uint32": &TstTypesData{
+            Args: []string{"32"}, Expected: uint32(32), Got: ptr_to(uint32(0)),
+        },
+        "uintptr": &TstTypesData{
+            Args: []string{"0x10"},
+            Expected: uintptr(16),
+            Got: ptr_to(uintptr(0)),
+        },
+        "float32": &TstTypesData{
+            Args: []string{"1.5"},
+            Expected: float32(1.5),
+            Got: ptr_to(float32(0)),
+        },
+        "complex128": &TstTypesData{
+            Args: []string{"1+2i"},
+            Expected: complex(1, 2),
+            Got: ptr_to(complex128(0)),
+        },
+        "port": &TstTypesData{
+            Args: []string{"8080"}, Expected: Port(8080), Got: ptr_to(Port(0)),
+        },
+        "duration": &TstTypesData{
+            Args: []string{"1m30s"},
+            Expected: 90 * time.Second,
+            Got: ptr_to(time.Duration(0)),
+        },
+        "time": &TstTypesData{
+            Args: []string{"2020-01-02T03:04:05Z"},
+            Expected: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+            Got: ptr_to(time.Time{}),
+        },
     }
 
     param_names := make([]string, 0, len(test_data))
@@ -244,6 +351,44 @@ func TestFlagSetSlices(t *testing.T) {
             Expected: []string{"d3d", "b3f"},
             Got: ptr_to([]string{}),
         },
+        "int8": &TstTypesData{
+            Args: []string{"-1", "2"},
+            Expected: []int8{-1, 2},
+            Got: ptr_to([]int8{}),
+        },
+        "uint16": &TstTypesData{
+            Args: []string{"1", "65535"},
+            Expected: []uint16{1, 65535},
+            Got: ptr_to([]uint16{}),
+        },
+        "float32": &TstTypesData{
+            Args: []string{"1.5", "2.25"},
+            Expected: []float32{1.5, 2.25},
+            Got: ptr_to([]float32{}),
+        },
+        "complex64": &TstTypesData{
+            Args: []string{"1i", "2"},
+            Expected: []complex64{complex(0, 1), complex(2, 0)},
+            Got: ptr_to([]complex64{}),
+        },
+        "port": &TstTypesData{
+            Args: []string{"80", "443"},
+            Expected: []Port{80, 443},
+            Got: ptr_to([]Port{}),
+        },
+        "duration": &TstTypesData{
+            Args: []string{"1s", "2h"},
+            Expected: []time.Duration{time.Second, 2 * time.Hour},
+            Got: ptr_to([]time.Duration{}),
+        },
+        "time": &TstTypesData{
+            Args: []string{"2020-01-02T03:04:05Z", "2021-02-03T04:05:06Z"},
+            Expected: []time.Time{
+                time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+                time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+            },
+            Got: ptr_to([]time.Time{}),
+        },
     }
 
     param_names := make([]string, 0, len(test_data))
@@ -291,6 +436,64 @@ func TestFlagSetSlices(t *testing.T) {
     }
 }
 
+func TestFlagSetSlicesDecimal(t *testing.T) {
+    var ints []int
+    var int64s []int64
+    var uints []uint
+    var uint64s []uint64
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.Flag(&ints, "int", "Ints")
+    flags.Flag(&int64s, "int64", "Int64s")
+    flags.Flag(&uints, "uint", "Uints")
+    flags.Flag(&uint64s, "uint64", "Uint64s")
+
+    var args []string
+    for _, param := range []string{"int", "int64", "uint", "uint64"} {
+        args = append(args, "-" + param, "08", "-" + param, "010")
+    }
+    if err := flags.Parse(args); err != nil {
+        t.Fatalf("error parsing options: %s", err)
+    }
+
+    got := []interface{}{ints, int64s, uints, uint64s}
+    expected := []interface{}{[]int{8, 10}, []int64{8, 10}, []uint{8, 10},
+        []uint64{8, 10}}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %+v, expected %+v", got, expected)
+    }
+}
+
+type Port uint16
+
+func TestFlagSetRange(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+
+    port := Port(0)
+    ports := []uint8{}
+    flags.Flag(&port, "port", "Port")
+    flags.FlagSep(&ports, "ports", "Ports", ",")
+
+    for _, args := range [][]string{{"-port=70000"}, {"-ports", "1,256"}} {
+        err := flags.Parse(args)
+        var inv_err *flagutil.InvalidValueError
+        if !errors.As(err, &inv_err) {
+            t.Errorf("expected an *InvalidValueError for %q, got %v", args,
+                err)
+            continue
+        }
+
+        if !errors.Is(err, strconv.ErrRange) {
+            t.Errorf("expected a range error for %q, got %v", args, err)
+        }
+        if !strings.HasPrefix(args[0], "-" + inv_err.Flag) {
+            t.Errorf("wrong flag in error for %q: %s", args, inv_err.Flag)
+        }
+    }
+}
+
 type MyFlagStruct struct {
     IP string `flagutil:"ip, usage='The IP address'"`
     Count int `flagutil:"cnt,usage='The count'"`
@@ -304,6 +507,62 @@ type MyFlagStructWithSlices struct {
     Counts []int `flagutil:"cnt,usage='The count'"`
 }
 
+type MyFlagStructWithTimes struct {
+    Timeout time.Duration `flagutil:"timeout,usage='Timeout'"`
+    Cutoff time.Time `flagutil:"cutoff,layout='2006-01-02',usage='Cutoff'"`
+    Days []time.Time `flagutil:"day,del=',',layout='2006-01-02'"`
+    Since *time.Time `flagutil:"since,layout='2006-01-02',usage='Since'"`
+    Until []*time.Time `flagutil:"until,layout='2006-01-02',usage='Until'"`
+}
+
+func TestFromStructWithTimes(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(MyFlagStructWithTimes)
+    err := flags.FlagFromStruct(data)
+    if err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    args := []string{"-timeout", "5s", "-cutoff", "2020-03-04",
+        "-day", "2020-01-01,2020-01-02", "-since", "2019-05-06",
+        "-until", "2021-07-08"}
+    err = flags.Parse(args)
+    if err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if data.Timeout != 5 * time.Second {
+        t.Errorf("Timeout incorrect. Got %s, expected 5s", data.Timeout)
+    }
+
+    expected := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+    if !data.Cutoff.Equal(expected) {
+        t.Errorf("Cutoff incorrect. Got %s, expected %s", data.Cutoff,
+            expected)
+    }
+
+    expected_days := []time.Time{
+        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+        time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+    }
+    if !reflect.DeepEqual(data.Days, expected_days) {
+        t.Errorf("Days incorrect. Got %+v, expected %+v", data.Days,
+            expected_days)
+    }
+
+    expected = time.Date(2019, 5, 6, 0, 0, 0, 0, time.UTC)
+    if data.Since == nil || !data.Since.Equal(expected) {
+        t.Errorf("Since incorrect. Got %v, expected %s", data.Since, expected)
+    }
+    expected = time.Date(2021, 7, 8, 0, 0, 0, 0, time.UTC)
+    if len(data.Until) != 1 || !data.Until[0].Equal(expected) {
+        t.Errorf("Until incorrect. Got %v, expected [%s]", data.Until,
+            expected)
+    }
+}
+
 func TestFromStruct(t *testing.T) {
     flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
     data := new(MyFlagStruct)
@@ -331,6 +590,130 @@ func TestFromStruct(t *testing.T) {
     }
 }
 
+func TestParseContinueOnError(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+
+    nums := []int{42}
+    flags.Flag(&nums, "num", "Number")
+
+    err := flags.Parse([]string{"-num", "1", "-num", "x"})
+    if err == nil {
+        t.Errorf("expected an error parsing invalid int")
+        return
+    }
+
+    var parse_err *flagutil.ParseError
+    if !errors.As(err, &parse_err) {
+        t.Errorf("expected a *ParseError, got %T: %s", err, err)
+    } else if parse_err.FlagSet != "test" {
+        t.Errorf("wrong FlagSet name in error. Got %q, expected %q",
+            parse_err.FlagSet, "test")
+    }
+
+    if !reflect.DeepEqual(nums, []int{42}) {
+        t.Errorf("slice modified on failed parse. Got %+v", nums)
+    }
+
+    err = flags.Parse([]string{"-h"})
+    if err != flagutil.ErrHelp {
+        t.Errorf("expected ErrHelp, got %v", err)
+    }
+}
+
+func TestGetFlagSetParsed(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+
+    var name string
+    flags.Flag(&name, "name", "Name")
+
+    if flags.GetFlagSet().Parsed() {
+        t.Errorf("underlying FlagSet reports Parsed() before parsing")
+    }
+    err := flags.Parse([]string{"-name", "x", "--", "-a", "b"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+
+    under := flags.GetFlagSet()
+    if !under.Parsed() {
+        t.Errorf("underlying FlagSet does not report Parsed()")
+    }
+    expected := []string{"-a", "b"}
+    if !reflect.DeepEqual(under.Args(), expected) || under.NArg() != 2 {
+        t.Errorf("underlying FlagSet has args %q, expected %q",
+            under.Args(), expected)
+    }
+    if f := under.Lookup("name"); f == nil || f.Value.String() != "x" {
+        t.Errorf("underlying FlagSet has the wrong value for -name")
+    }
+}
+
+func TestParsePanicOnError(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.PanicOnError)
+    flags.SetOutput(io.Discard)
+
+    nums := []int{}
+    flags.Flag(&nums, "num", "Number")
+
+    defer func() {
+        r := recover()
+        if r == nil {
+            t.Errorf("expected a panic")
+            return
+        }
+        err, ok := r.(error)
+        if !ok {
+            t.Errorf("expected to panic with an error, got %T", r)
+            return
+        }
+        var parse_err *flagutil.ParseError
+        if !errors.As(err, &parse_err) {
+            t.Errorf("expected a *ParseError, got %T: %s", err, err)
+        }
+    }()
+
+    flags.Parse([]string{"-num", "x"})
+}
+
+func TestParseExitOnError(t *testing.T) {
+    if args := os.Getenv("FLAGUTIL_TEST_EXIT_ARGS"); args != "" {
+        flags := flagutil.NewFlagSet("test", flagutil.ExitOnError)
+        flags.SetOutput(io.Discard)
+        nums := []int{}
+        flags.Flag(&nums, "num", "Number")
+        flags.Parse(strings.Split(args, " "))
+        os.Exit(1)
+    }
+
+    exit_codes := map[string]int{
+        "-num x": 2,
+        "-bogus": 2,
+        "-h": 0,
+        "-num 1": 1,
+    }
+
+    for args, expected := range exit_codes {
+        cmd := exec.Command(os.Args[0], "-test.run=^TestParseExitOnError$")
+        cmd.Env = append(os.Environ(), "FLAGUTIL_TEST_EXIT_ARGS=" + args)
+        err := cmd.Run()
+
+        code := 0
+        if exit_err, ok := err.(*exec.ExitError); ok {
+            code = exit_err.ExitCode()
+        } else if err != nil {
+            t.Errorf("couldn't run subprocess: %s", err)
+            continue
+        }
+
+        if code != expected {
+            t.Errorf("wrong exit code for args %q. Got %d, expected %d",
+                args, code, expected)
+        }
+    }
+}
+
 func ExampleFlagSet() {
     ip := ""
     default_ip := "127.0.0.1"
@@ -460,6 +843,48 @@ func ExampleFromStructWithSlices() {
     //         The IP address
 }
 
+func ExampleFlagSet_Flag() {
+    var names []string
+    var verbose bool
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.FlagSep(&names, "name", "Names", ",")
+    flags.Flag(&verbose, "v", "Verbose output")
+
+    flags.Parse([]string{"-name", "a,b", "-v", "-name", "c", "x"})
+
+    fmt.Printf("names: %q\n", names)
+    fmt.Printf("verbose: %t\n", verbose)
+    fmt.Printf("args: %q\n", flags.Args())
+
+    // Output:
+    // names: ["a" "b" "c"]
+    // verbose: true
+    // args: ["x"]
+}
+
+func ExampleFlagSet_FlagFromStruct() {
+    var data struct {
+        Host string `flagutil:"host,default='localhost',usage='Host'"`
+        Ports []int `flagutil:"port,del=',',usage='Ports'"`
+    }
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    if err := flags.FlagFromStruct(&data); err != nil {
+        fmt.Printf("error adding flags: %s\n", err)
+    }
+    if err := flags.Parse([]string{"-port", "80,443"}); err != nil {
+        fmt.Printf("error parsing flags: %s\n", err)
+    }
+
+    fmt.Printf("host: %s\n", data.Host)
+    fmt.Printf("ports: %v\n", data.Ports)
+
+    // Output:
+    // host: localhost
+    // ports: [80 443]
+}
+
 func ptr_to(intfc_val interface{}) interface{} {
     value := reflect.ValueOf(intfc_val)
     ptr_value := reflect.New(value.Type())
@@ -1,6 +1,6 @@
 module github.com/cuberat/go-flagutil
 
-go 1.14
+go 1.18
 
 require (
     github.com/cuberat/go-log v1.0.0
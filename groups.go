@@ -0,0 +1,243 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "flag"
+    "fmt"
+    "strings"
+)
+
+// A group of flags with a relationship checked after parsing.
+type flag_group struct {
+    name string
+    flags []string
+    exclusive bool    // At most one of the flags may be set.
+    at_least_one bool // At least one of the flags must be set.
+}
+
+// Declares that at most one of the flags `names` may be set, e.g., -file and
+// -url. To require exactly one, also call `AtLeastOne()` with the same
+// flags. This is equivalent to giving the flags the same "group" key, and
+// the "exclusive" key, in a struct tag.
+func (fs *FlagSet) MutuallyExclusive(names ...string) error {
+    return fs.new_group(names, true, false)
+}
+
+// Declares that at least one of the flags `names` must be set. This is
+// equivalent to giving the flags the same "group" key, and the "atleastone"
+// key, in a struct tag.
+func (fs *FlagSet) AtLeastOne(names ...string) error {
+    return fs.new_group(names, false, true)
+}
+
+// Declares that if the flag `name` is set, the flags `required` must also be
+// set, e.g., -cert requires -key. This is equivalent to the "requires" key in
+// a struct tag.
+func (fs *FlagSet) DependsOn(name string, required ...string) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    for _, other := range required {
+        if fs.flag_flagset.Lookup(other) == nil {
+            return fmt.Errorf("no such flag -%s", other)
+        }
+    }
+    spec.opts.requires = append(spec.opts.requires, required...)
+
+    return nil
+}
+
+func (fs *FlagSet) new_group(
+    names []string,
+    exclusive, at_least_one bool,
+) error {
+    if len(names) < 2 {
+        return fmt.Errorf("a group needs at least two flags")
+    }
+    for _, name := range names {
+        if fs.flag_flagset.Lookup(name) == nil {
+            return fmt.Errorf("no such flag -%s", name)
+        }
+    }
+
+    fs.groups = append(fs.groups, &flag_group{
+        flags: names,
+        exclusive: exclusive,
+        at_least_one: at_least_one,
+    })
+
+    return nil
+}
+
+// Adds the flag `name` to the named group declared via struct tags, creating
+// the group if needed.
+func (fs *FlagSet) add_to_group(
+    group, name string,
+    exclusive, at_least_one bool,
+) {
+    var g *flag_group
+    for _, existing := range fs.groups {
+        if existing.name == group {
+            g = existing
+            break
+        }
+    }
+    if g == nil {
+        g = &flag_group{name: group}
+        fs.groups = append(fs.groups, g)
+    }
+
+    g.flags = append(g.flags, name)
+    g.exclusive = g.exclusive || exclusive
+    g.at_least_one = g.at_least_one || at_least_one
+}
+
+// Adds the group `g` of persistent flags, unless it has already been added,
+// or one of its flags is shadowed by a flag of the FlagSet's own.
+func (fs *FlagSet) add_persistent_group(g *flag_group) {
+    for _, existing := range fs.groups {
+        if existing == g {
+            return
+        }
+    }
+
+    if fs.is_persistent_group(g) {
+        fs.groups = append(fs.groups, g)
+    }
+}
+
+// Reports whether all the flags in the group `g` are persistent.
+func (fs *FlagSet) is_persistent_group(g *flag_group) bool {
+    for _, name := range g.flags {
+        if !fs.persistent[name] {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Checks that the flags named by the "requires" struct tag key exist.
+func (fs *FlagSet) check_dependencies() error {
+    for _, spec := range fs.specs {
+        for _, other := range spec.opts.requires {
+            if fs.flag_flagset.Lookup(other) == nil {
+                return fmt.Errorf("flag -%s requires undefined flag -%s",
+                    spec.name, other)
+            }
+        }
+    }
+
+    return nil
+}
+
+// Checks the groups and dependencies against the flags that were set. If
+// `deferred` is true, persistent flags that must be set because of a group
+// or a dependency are left to the child command, as for required flags.
+func (fs *FlagSet) validate_groups(set map[string]bool, deferred bool) error {
+    for _, g := range fs.groups {
+        set_flags := []string{}
+        for _, name := range g.flags {
+            if set[name] {
+                set_flags = append(set_flags, name)
+            }
+        }
+
+        if g.exclusive && len(set_flags) > 1 {
+            return &FlagGroupError{Relation: "exclusive", Flags: set_flags}
+        }
+        if g.at_least_one && len(set_flags) == 0 &&
+            !(deferred && fs.is_persistent_group(g)) {
+            return &FlagGroupError{Relation: "atleastone", Flags: g.flags}
+        }
+    }
+
+    var err error
+    fs.flag_flagset.VisitAll(func(f *flag.Flag) {
+        spec, ok := fs.specs[f.Name]
+        if err != nil || !ok || !set[f.Name] {
+            return
+        }
+        missing := []string{}
+        for _, other := range spec.opts.requires {
+            if !set[other] && !(deferred && fs.persistent[other]) {
+                missing = append(missing, other)
+            }
+        }
+        if len(missing) > 0 {
+            err = &FlagGroupError{Relation: "requires", Flag: f.Name,
+                Flags: missing}
+        }
+    })
+
+    return err
+}
+
+// Returns notes about the groups and dependencies of the flag `name`, to show
+// in `PrintDefaults()`.
+func (fs *FlagSet) group_notes(name string) []string {
+    notes := []string{}
+    for _, g := range fs.groups {
+        if !contains(g.flags, name) {
+            continue
+        }
+
+        others := []string{}
+        for _, other := range g.flags {
+            if other != name {
+                others = append(others, other)
+            }
+        }
+        if g.exclusive {
+            notes = append(notes, "conflicts with " + dash_list(others))
+        }
+        if g.at_least_one && len(others) == 1 {
+            notes = append(notes, "required unless -" + others[0] + " is set")
+        } else if g.at_least_one {
+            notes = append(notes, "required unless one of " +
+                dash_list(others) + " is set")
+        }
+    }
+
+    if spec, ok := fs.specs[name]; ok && len(spec.opts.requires) > 0 {
+        notes = append(notes, "requires " + dash_list(spec.opts.requires))
+    }
+
+    return notes
+}
+
+// Formats flag names as, e.g., "-a, -b".
+func dash_list(names []string) string {
+    dashed := make([]string, len(names))
+    for i, name := range names {
+        dashed[i] = "-" + name
+    }
+
+    return strings.Join(dashed, ", ")
+}
@@ -0,0 +1,134 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestMultiArgMap(t *testing.T) {
+    ma := flagutil.NewMultiArgMap(",", ":")
+    for _, arg := range []string{"a:1,b:2", "c:x:y", "a:3"} {
+        if err := ma.Set(arg); err != nil {
+            t.Errorf("error setting %q: %s", arg, err)
+            return
+        }
+    }
+
+    expected := map[string]string{"a": "3", "b": "2", "c": "x:y"}
+    if !reflect.DeepEqual(ma.GetMap(), expected) {
+        t.Errorf("maps not equal. Got %+v, expected %+v", ma.GetMap(),
+            expected)
+    }
+
+    if err := ma.Set("novalue"); err == nil {
+        t.Errorf("expected an error for a missing separator")
+    }
+
+    ma.ErrorOnDup = true
+    if err := ma.Set("b:5"); err == nil {
+        t.Errorf("expected an error for a duplicate key")
+    }
+}
+
+func TestFlagSetMaps(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+
+    labels := map[string]string{}
+    limits := map[string]int{}
+    timeouts := map[string]time.Duration{}
+    flags.Flag(&labels, "label", "Labels")
+    flags.FlagSep(&limits, "limit", "Limits", ",")
+    flags.Flag(&timeouts, "timeout", "Timeouts")
+
+    args := []string{"-label", "env=prod", "-label", "team=core",
+        "-limit", "cpu=2,mem=512", "-timeout", "read=5s"}
+    if err := flags.Parse(args); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    expected_labels := map[string]string{"env": "prod", "team": "core"}
+    if !reflect.DeepEqual(labels, expected_labels) {
+        t.Errorf("labels incorrect. Got %+v, expected %+v", labels,
+            expected_labels)
+    }
+
+    expected_limits := map[string]int{"cpu": 2, "mem": 512}
+    if !reflect.DeepEqual(limits, expected_limits) {
+        t.Errorf("limits incorrect. Got %+v, expected %+v", limits,
+            expected_limits)
+    }
+
+    if timeouts["read"] != 5 * time.Second {
+        t.Errorf("timeouts incorrect. Got %+v", timeouts)
+    }
+}
+
+type MapFlags struct {
+    Env map[string]string `flagutil:"env,del=';',kvsep=':',dupkeys='error'"`
+    Weights map[string]float64 `flagutil:"weight,del=','"`
+}
+
+func TestFromStructWithMaps(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    data := new(MapFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    args := []string{"-env", "a:1;b:2", "-weight", "x=0.5,y=1.5"}
+    if err := flags.Parse(args); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    expected_env := map[string]string{"a": "1", "b": "2"}
+    if !reflect.DeepEqual(data.Env, expected_env) {
+        t.Errorf("Env incorrect. Got %+v, expected %+v", data.Env,
+            expected_env)
+    }
+
+    expected_weights := map[string]float64{"x": 0.5, "y": 1.5}
+    if !reflect.DeepEqual(data.Weights, expected_weights) {
+        t.Errorf("Weights incorrect. Got %+v, expected %+v", data.Weights,
+            expected_weights)
+    }
+
+    flags = flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    data = new(MapFlags)
+    flags.FlagFromStruct(data)
+
+    err := flags.Parse([]string{"-env", "a:1", "-env", "a:2"})
+    var inv_err *flagutil.InvalidValueError
+    if !errors.As(err, &inv_err) || inv_err.Flag != "env" {
+        t.Errorf("expected an *InvalidValueError for a duplicate key, " +
+            "got %v", err)
+    }
+
+    err = flags.Parse([]string{"-weight", "x=abc"})
+    if !errors.As(err, &inv_err) || inv_err.Flag != "weight" {
+        t.Errorf("expected an *InvalidValueError for a bad value, got %v",
+            err)
+    }
+}
+
+type BadDupKeys struct {
+    Env map[string]string `flagutil:"env,dupkeys='first'"`
+}
+
+func TestBadDupKeysTag(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    err := flags.FlagFromStruct(new(BadDupKeys))
+
+    var tag_err *flagutil.TagError
+    if !errors.As(err, &tag_err) {
+        t.Errorf("expected a *TagError, got %v", err)
+    }
+}
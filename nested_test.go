@@ -0,0 +1,105 @@
+package flagutil_test
+
+import (
+    "bytes"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+type DBConfig struct {
+    Host string `flagutil:"host,usage='Database host'"`
+    Port int `flagutil:"port,usage='Database port'"`
+}
+
+type LogConfig struct {
+    Level string `flagutil:"log-level,usage='Log level'"`
+}
+
+type tlsConfig struct {
+    Cert string `flagutil:"cert,usage='Certificate file'"`
+}
+
+type NestedFlags struct {
+    LogConfig
+    tlsConfig
+    DB DBConfig `flagutil:"db"`
+    Replica *DBConfig `flagutil:"replica,prefix='replica-'"`
+    Cache *DBConfig `flagutil:"cache"`
+    Start time.Time `flagutil:"start,usage='Start time'"`
+}
+
+func TestNestedStructs(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    data := new(NestedFlags)
+    data.DB.Port = 5432
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    err := flags.Parse([]string{"-db.host", "db1", "-replica-port", "6543",
+        "-log-level", "debug", "-cert", "a.pem",
+        "-start", "2020-01-02T03:04:05Z"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+
+    if data.DB.Host != "db1" || data.DB.Port != 5432 {
+        t.Errorf("DB incorrect. Got %+v", data.DB)
+    }
+    if data.Replica == nil || data.Replica.Port != 6543 {
+        t.Errorf("Replica incorrect. Got %+v", data.Replica)
+    }
+    if data.Cache != nil {
+        t.Errorf("Cache should not be allocated. Got %+v", data.Cache)
+    }
+    if data.Level != "debug" {
+        t.Errorf("Level incorrect. Got %q, expected %q", data.Level, "debug")
+    }
+    if data.Cert != "a.pem" {
+        t.Errorf("Cert incorrect. Got %q, expected %q", data.Cert, "a.pem")
+    }
+    if data.Start.Year() != 2020 {
+        t.Errorf("Start incorrect. Got %s", data.Start)
+    }
+}
+
+func TestNestedStructPrintDefaults(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    buf := new(bytes.Buffer)
+    flags.SetOutput(buf)
+    if err := flags.FlagFromStruct(new(NestedFlags)); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    flags.PrintDefaults()
+
+    for _, name := range []string{"-db.host", "-db.port", "-replica-host",
+        "-cache.port", "-log-level", "-cert"} {
+        if !strings.Contains(buf.String(), "  " + name + " ") {
+            t.Errorf("missing flag %s in defaults:\n%s", name, buf.String())
+        }
+    }
+}
+
+func TestNestedStructEnv(t *testing.T) {
+    t.Setenv("APP_CACHE_HOST", "cache.example.com")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.SetEnvPrefix("APP_")
+    data := new(NestedFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    if err := flags.Parse([]string{}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+
+    // Flags set from the environment count when allocating pointers.
+    if data.Cache == nil || data.Cache.Host != "cache.example.com" {
+        t.Errorf("Cache incorrect. Got %+v", data.Cache)
+    }
+}
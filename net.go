@@ -0,0 +1,146 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "fmt"
+    "net"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// A network address of the form "host:port", as accepted by `net.Dial()`.
+// The port must be numeric. The host may be a host name, an IP address (IPv6
+// addresses must be enclosed in square brackets), or empty, e.g., ":8080".
+//
+// HostPort implements `flag.Value`, so it can be bound to a flag with
+// `Flag()`, either on its own or as a slice.
+type HostPort struct {
+    Host string
+    Port uint16
+}
+
+// Parses and validates a "host:port" string.
+func ParseHostPort(s string) (HostPort, error) {
+    host, port_str, err := net.SplitHostPort(s)
+    if err != nil {
+        return HostPort{}, err
+    }
+
+    port, err := strconv.ParseUint(port_str, 10, 16)
+    if err != nil {
+        return HostPort{}, fmt.Errorf("invalid port %q in address %q",
+            port_str, s)
+    }
+
+    if host != "" && net.ParseIP(host) == nil && !is_valid_host_name(host) {
+        return HostPort{}, fmt.Errorf("invalid host %q in address %q", host,
+            s)
+    }
+
+    return HostPort{Host: host, Port: uint16(port)}, nil
+}
+
+// Returns the address in "host:port" form, or "" for the zero value.
+func (hp HostPort) String() string {
+    if hp == (HostPort{}) {
+        return ""
+    }
+    return net.JoinHostPort(hp.Host, strconv.Itoa(int(hp.Port)))
+}
+
+// Parses `s` and stores the result. Implements `flag.Value`.
+func (hp *HostPort) Set(s string) error {
+    parsed, err := ParseHostPort(s)
+    if err != nil {
+        return err
+    }
+    *hp = parsed
+
+    return nil
+}
+
+// Implements `encoding.TextMarshaler`.
+func (hp HostPort) MarshalText() ([]byte, error) {
+    return []byte(hp.String()), nil
+}
+
+// Implements `encoding.TextUnmarshaler`.
+func (hp *HostPort) UnmarshalText(text []byte) error {
+    return hp.Set(string(text))
+}
+
+// Reports whether `host` is a syntactically valid host name (RFC 1123),
+// allowing underscores, which are common in practice.
+func is_valid_host_name(host string) bool {
+    host = strings.TrimSuffix(host, ".")
+    if len(host) == 0 || len(host) > 253 {
+        return false
+    }
+
+    for _, label := range strings.Split(host, ".") {
+        if len(label) == 0 || len(label) > 63 {
+            return false
+        }
+        if label[0] == '-' || label[len(label) - 1] == '-' {
+            return false
+        }
+        for _, ch := range label {
+            switch {
+            case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z',
+                ch >= '0' && ch <= '9', ch == '-', ch == '_':
+            default:
+                return false
+            }
+        }
+    }
+
+    return true
+}
+
+// `net.IPNet` does not implement `encoding.TextUnmarshaler`, so CIDR
+// notation is parsed here. As with `net.ParseCIDR()`, the result is the
+// network, e.g., "10.1.2.3/8" is stored as 10.0.0.0/8.
+func parse_ipnet(s string) (reflect.Value, error) {
+    _, ipnet, err := net.ParseCIDR(s)
+    if err != nil {
+        return reflect.Value{}, err
+    }
+
+    return reflect.ValueOf(ipnet), nil
+}
+
+// Like `parse_ipnet()`, but returns a `net.IPNet` instead of a pointer.
+func parse_ipnet_value(s string) (reflect.Value, error) {
+    ipnet, err := parse_ipnet(s)
+    if err != nil {
+        return reflect.Value{}, err
+    }
+
+    return ipnet.Elem(), nil
+}
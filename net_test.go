@@ -0,0 +1,130 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "net"
+    "net/netip"
+    "reflect"
+    "testing"
+)
+
+type NetFlags struct {
+    IP net.IP `flagutil:"ip"`
+    Net *net.IPNet `flagutil:"net"`
+    Nets []net.IPNet `flagutil:"nets,del=','"`
+    Addr netip.Addr `flagutil:"addr"`
+    Prefix netip.Prefix `flagutil:"prefix"`
+    AddrPort netip.AddrPort `flagutil:"addrport"`
+    Listen flagutil.HostPort `flagutil:"listen"`
+    Peers []flagutil.HostPort `flagutil:"peer,del=','"`
+}
+
+func TestNetTypes(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(NetFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    args := []string{"-ip", "192.168.1.1", "-net", "10.1.2.3/8",
+        "-nets", "172.16.0.0/12,fd00::/8", "-addr", "::1",
+        "-prefix", "192.168.0.0/16", "-addrport", "[::1]:53",
+        "-listen", ":8080", "-peer", "db.example.com:5432,[fe80::1]:22"}
+    if err := flags.Parse(args); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if data.IP.String() != "192.168.1.1" {
+        t.Errorf("IP incorrect. Got %s", data.IP)
+    }
+    if data.Net == nil || data.Net.String() != "10.0.0.0/8" {
+        t.Errorf("Net incorrect. Got %v", data.Net)
+    }
+    if len(data.Nets) != 2 || data.Nets[1].String() != "fd00::/8" {
+        t.Errorf("Nets incorrect. Got %+v", data.Nets)
+    }
+    if data.Addr != netip.MustParseAddr("::1") {
+        t.Errorf("Addr incorrect. Got %s", data.Addr)
+    }
+    if data.Prefix != netip.MustParsePrefix("192.168.0.0/16") {
+        t.Errorf("Prefix incorrect. Got %s", data.Prefix)
+    }
+    if data.AddrPort != netip.MustParseAddrPort("[::1]:53") {
+        t.Errorf("AddrPort incorrect. Got %s", data.AddrPort)
+    }
+    if data.Listen != (flagutil.HostPort{Port: 8080}) {
+        t.Errorf("Listen incorrect. Got %+v", data.Listen)
+    }
+
+    expected_peers := []flagutil.HostPort{
+        {Host: "db.example.com", Port: 5432},
+        {Host: "fe80::1", Port: 22},
+    }
+    if !reflect.DeepEqual(data.Peers, expected_peers) {
+        t.Errorf("Peers incorrect. Got %+v, expected %+v", data.Peers,
+            expected_peers)
+    }
+}
+
+func TestNetTypesInvalid(t *testing.T) {
+    tests := map[string][]string{
+        "ip": {"-ip", "300.1.1.1"},
+        "net": {"-net", "10.0.0.0/33"},
+        "addr": {"-addr", "not-an-ip"},
+        "listen": {"-listen", "localhost:99999"},
+        "peer": {"-peer", "bad_host!:80"},
+    }
+
+    for name, args := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            flags.SetOutput(io.Discard)
+            data := new(NetFlags)
+            if err := flags.FlagFromStruct(data); err != nil {
+                st.Errorf("error adding flags: %s", err)
+                return
+            }
+
+            err := flags.Parse(args)
+            var inv_err *flagutil.InvalidValueError
+            if !errors.As(err, &inv_err) {
+                st.Errorf("expected an *InvalidValueError, got %v", err)
+                return
+            }
+            if inv_err.Flag != name {
+                st.Errorf("wrong flag in error. Got %q, expected %q",
+                    inv_err.Flag, name)
+            }
+        })
+    }
+}
+
+func TestParseHostPort(t *testing.T) {
+    valid := map[string]flagutil.HostPort{
+        "localhost:80": {Host: "localhost", Port: 80},
+        "[::1]:443": {Host: "::1", Port: 443},
+        ":0": {},
+    }
+    for s, expected := range valid {
+        hp, err := flagutil.ParseHostPort(s)
+        if err != nil {
+            t.Errorf("error parsing %q: %s", s, err)
+            continue
+        }
+        if hp != expected {
+            t.Errorf("wrong result for %q. Got %+v, expected %+v", s, hp,
+                expected)
+        }
+    }
+
+    for _, s := range []string{"localhost", "host:http", "-host:80",
+        "a..b:80", "::1:80"} {
+        if _, err := flagutil.ParseHostPort(s); err == nil {
+            t.Errorf("expected an error parsing %q", s)
+        }
+    }
+}
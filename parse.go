@@ -0,0 +1,337 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "flag"
+    "fmt"
+    "unicode/utf8"
+)
+
+// Implemented by flag.Value types for flags that do not take an argument,
+// e.g., bool flags.
+type bool_flag interface {
+    flag.Value
+    IsBoolFlag() bool
+}
+
+// Syntax of command-line flags accepted by `Parse()`. See `SetSyntax()`.
+type Syntax int
+
+const (
+    // The syntax of the flag module: "-name", "--name", "-name=value", or
+    // "-name value". This is the default.
+    GoSyntax Syntax = iota
+
+    // GNU/POSIX-style syntax: long names are given as "--name",
+    // "--name=value", or "--name value", and one-character names as "-n",
+    // "-nvalue", or "-n value". Several one-character boolean flags may be
+    // combined, e.g., "-vx" is the same as "-v -x".
+    GNUSyntax
+)
+
+// Sets the syntax used to parse command-line flags. In either syntax, "--"
+// terminates the flags, and one-character aliases defined via
+// `FlagShort()` or the "short" struct tag key may be used in place of the
+// full flag name. Subcommands declared via `FlagFromStruct()` use the syntax
+// of their parent, as do child commands (see `Command`) whose syntax has not
+// been set.
+func (fs *FlagSet) SetSyntax(syntax Syntax) {
+    fs.syntax = syntax
+    fs.syntax_set = true
+}
+
+// Sets whether flags may appear anywhere on the command line, e.g.,
+// "file1 -v file2", rather than only before the first non-flag argument. In
+// that case, only "--" terminates the flags, and `Args()` returns the
+// non-flag arguments in the order they were given. This has no effect if
+// subcommands were declared via `FlagFromStruct()`, or for a `Command` with
+// children, since the first non-flag argument selects the subcommand, but
+// subcommands inherit the setting (child commands only if it has not been
+// set for them).
+func (fs *FlagSet) SetInterspersed(interspersed bool) {
+    fs.interspersed = interspersed
+    fs.interspersed_set = true
+}
+
+// Checks that `short` can be used as a one-character alias for the flag
+// `name`.
+func (fs *FlagSet) check_short(name, short string) error {
+    if utf8.RuneCountInString(short) != 1 || short == "-" || short == "=" {
+        return fmt.Errorf("invalid short name %q for flag %q: must be a " +
+            "single character", short, name)
+    }
+    if other, ok := fs.shorts[short]; ok {
+        return fmt.Errorf("short name %q for flag %q is already used by " +
+            "flag %q", short, name, other)
+    }
+    if fs.flag_flagset.Lookup(short) != nil {
+        return fmt.Errorf("short name %q for flag %q is already the name " +
+            "of a flag", short, name)
+    }
+
+    return nil
+}
+
+// Checks that `name` is not already used as a one-character alias, since
+// the alias would be shadowed by the new flag in `GoSyntax`.
+func (fs *FlagSet) check_long(name string) error {
+    if other, ok := fs.shorts[name]; ok {
+        return fmt.Errorf("flag name %q is already used as the short name " +
+            "of flag %q", name, other)
+    }
+
+    return nil
+}
+
+// Returns the one-character alias for the flag `name`, if any.
+func (fs *FlagSet) short_name(name string) string {
+    for short, long := range fs.shorts {
+        if long == name {
+            return short
+        }
+    }
+
+    return ""
+}
+
+// Looks up the flag named by `name` in the argument `arg` at position `pos`.
+// If `long` is false, `name` may be a one-character alias.
+func (fs *FlagSet) lookup_arg(
+    name, arg string,
+    pos int,
+    long bool,
+) (*flag.Flag, error) {
+    f := fs.flag_flagset.Lookup(name)
+    if f == nil && !long {
+        if full_name, ok := fs.shorts[name]; ok {
+            f = fs.flag_flagset.Lookup(full_name)
+        }
+    }
+    if f == nil {
+        if name == "help" || name == "h" {
+            return nil, ErrHelp
+        }
+        return nil, &UnknownFlagError{
+            FlagError{Flag: name, Value: arg, Pos: pos},
+        }
+    }
+
+    return f, nil
+}
+
+// Sets the flag `f` given by the argument at `flag_pos`. If `has_value` is
+// false and the flag takes a value, the value is the next argument. Returns
+// the position of the argument following the flag.
+func (fs *FlagSet) set_arg(
+    args []string,
+    flag_pos int,
+    f *flag.Flag,
+    value string,
+    has_value bool,
+) (int, error) {
+    pos := flag_pos + 1
+    value_pos := flag_pos
+    if bf, ok := f.Value.(bool_flag); ok && bf.IsBoolFlag() {
+        if !has_value {
+            value = "true"
+        }
+    } else {
+        // The value may be the next argument.
+        if !has_value && pos < len(args) {
+            has_value = true
+            value = args[pos]
+            value_pos = pos
+            pos++
+        }
+        if !has_value {
+            return pos, &MissingValueError{
+                FlagError{Flag: f.Name, Value: args[flag_pos], Pos: flag_pos},
+            }
+        }
+    }
+
+    if err := fs.flag_flagset.Set(f.Name, value); err != nil {
+        return pos, &InvalidValueError{
+            FlagError{Flag: f.Name, Value: value, Pos: value_pos, Err: err},
+        }
+    }
+
+    return pos, nil
+}
+
+// Parses the flags in `args`, following the syntax selected by
+// `SetSyntax()`. Values are set via the underlying flag.FlagSet, so that
+// `Visit()` reports them as set. Returns the remaining (non-flag) arguments.
+func (fs *FlagSet) parse_args(args []string) ([]string, error) {
+    if fs.syntax == GNUSyntax {
+        return fs.parse_gnu_args(args)
+    }
+
+    interspersed := fs.interspersed_args()
+    positional := []string{}
+    pos := 0
+    for pos < len(args) {
+        s := args[pos]
+        if len(s) < 2 || s[0] != '-' {
+            if !interspersed {
+                break
+            }
+            positional = append(positional, s)
+            pos++
+            continue
+        }
+
+        num_minuses := 1
+        if s[1] == '-' {
+            num_minuses++
+            if len(s) == 2 {
+                // "--" terminates the flags.
+                pos++
+                break
+            }
+        }
+
+        name := s[num_minuses:]
+        if len(name) == 0 || name[0] == '-' || name[0] == '=' {
+            return nil, &FlagSyntaxError{
+                FlagError{Value: s, Pos: pos},
+            }
+        }
+
+        name, value, has_value := split_flag_value(name)
+        f, err := fs.lookup_arg(name, s, pos, false)
+        if err != nil {
+            return nil, err
+        }
+        pos, err = fs.set_arg(args, pos, f, value, has_value)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return join_positional(positional, args[pos:]), nil
+}
+
+// Parses the flags in `args` using `GNUSyntax`.
+func (fs *FlagSet) parse_gnu_args(args []string) ([]string, error) {
+    interspersed := fs.interspersed_args()
+    positional := []string{}
+    pos := 0
+    for pos < len(args) {
+        s := args[pos]
+        if len(s) < 2 || s[0] != '-' {
+            if !interspersed {
+                break
+            }
+            positional = append(positional, s)
+            pos++
+            continue
+        }
+        if s == "--" {
+            pos++
+            break
+        }
+
+        if s[1] == '-' {
+            name := s[2:]
+            if name[0] == '-' || name[0] == '=' {
+                return nil, &FlagSyntaxError{
+                    FlagError{Value: s, Pos: pos},
+                }
+            }
+
+            name, value, has_value := split_flag_value(name)
+            f, err := fs.lookup_arg(name, s, pos, true)
+            if err != nil {
+                return nil, err
+            }
+            pos, err = fs.set_arg(args, pos, f, value, has_value)
+            if err != nil {
+                return nil, err
+            }
+            continue
+        }
+
+        // One or more one-character flags. Boolean flags may be combined.
+        // The first flag that takes a value consumes the rest of the
+        // argument, or the next argument.
+        shorts := []rune(s[1:])
+        next := pos + 1
+        for i, ch := range shorts {
+            f, err := fs.lookup_arg(string(ch), s, pos, false)
+            if err != nil {
+                return nil, err
+            }
+
+            if bf, ok := f.Value.(bool_flag); ok && bf.IsBoolFlag() {
+                _, err := fs.set_arg(args, pos, f, "true", true)
+                if err != nil {
+                    return nil, err
+                }
+                continue
+            }
+
+            rest := string(shorts[i + 1:])
+            next, err = fs.set_arg(args, pos, f, rest, rest != "")
+            if err != nil {
+                return nil, err
+            }
+            break
+        }
+        pos = next
+    }
+
+    return join_positional(positional, args[pos:]), nil
+}
+
+// Reports whether flags may follow non-flag arguments. See
+// `SetInterspersed()`.
+func (fs *FlagSet) interspersed_args() bool {
+    return fs.interspersed && len(fs.subcommands) == 0 && !fs.has_commands
+}
+
+// Returns the non-flag arguments found before the end of the flags,
+// followed by those after it.
+func join_positional(positional, rest []string) []string {
+    if len(positional) == 0 {
+        return rest
+    }
+
+    return append(positional, rest...)
+}
+
+// Splits "name=value" into its parts.
+func split_flag_value(s string) (name, value string, has_value bool) {
+    for i := 1; i < len(s); i++ {
+        if s[i] == '=' {
+            return s[0:i], s[i + 1:], true
+        }
+    }
+
+    return s, "", false
+}
@@ -0,0 +1,180 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// A positional argument declared by a struct field tagged with "pos".
+type positional struct {
+    name string
+    usage string
+    index int
+    field reflect.Value
+    parse parse_func
+    variadic bool // The field is a slice that takes the remaining arguments.
+}
+
+// Declares a positional argument at `index` bound to `field`. If `field` is
+// a slice (of a type that doesn't parse itself from a single argument), it
+// takes all remaining arguments.
+func (fs *FlagSet) add_positional(
+    field reflect.Value,
+    name, usage string,
+    index int,
+) error {
+    for _, p := range fs.positionals {
+        if p.index == index {
+            return fmt.Errorf("positional argument %d redefined: %s and %s",
+                index, p.name, name)
+        }
+    }
+
+    p := &positional{name: name, usage: usage, index: index, field: field}
+    t := field.Type()
+    if t.Kind() == reflect.Slice && unmarshaler_parse_func(t) == nil {
+        p.variadic = true
+        t = t.Elem()
+    }
+    p.parse = get_parse_func(t)
+    if p.parse == nil {
+        return unsupported_type_error(name, field.Type(), nil)
+    }
+
+    fs.positionals = append(fs.positionals, p)
+    sort.Slice(fs.positionals, func(i, j int) bool {
+        return fs.positionals[i].index < fs.positionals[j].index
+    })
+
+    return nil
+}
+
+// Checks that the positional arguments are numbered consecutively from 0,
+// and that only the last one is variadic.
+func (fs *FlagSet) check_positionals() error {
+    if len(fs.positionals) > 0 && len(fs.subcommands) > 0 {
+        return fmt.Errorf("positional arguments can't be combined with " +
+            "subcommands")
+    }
+
+    for i, p := range fs.positionals {
+        if p.index != i {
+            return fmt.Errorf("positional argument %d is missing", i)
+        }
+        if p.variadic && i != len(fs.positionals) - 1 {
+            return fmt.Errorf("positional argument %s takes the remaining " +
+                "arguments, so it must be last", p.name)
+        }
+    }
+
+    return nil
+}
+
+// Converts the non-flag arguments and stores them in the fields for the
+// positional arguments. No fields are changed if an error is returned.
+func (fs *FlagSet) apply_positionals() error {
+    if len(fs.positionals) == 0 {
+        return nil
+    }
+
+    values := make([]reflect.Value, len(fs.positionals))
+    for i, p := range fs.positionals {
+        if p.variadic {
+            slice := reflect.MakeSlice(p.field.Type(), 0, len(fs.args) - i)
+            for j := i; j < len(fs.args); j++ {
+                v, err := p.parse(fs.args[j])
+                if err != nil {
+                    return &ArgumentError{Name: p.name, Value: fs.args[j],
+                        Pos: j, Err: err}
+                }
+                slice = reflect.Append(slice, v)
+            }
+            values[i] = slice
+            continue
+        }
+
+        if i >= len(fs.args) {
+            return &ArgumentError{Name: p.name, Pos: i}
+        }
+        v, err := p.parse(fs.args[i])
+        if err != nil {
+            return &ArgumentError{Name: p.name, Value: fs.args[i], Pos: i,
+                Err: err}
+        }
+        values[i] = v
+    }
+
+    last := fs.positionals[len(fs.positionals) - 1]
+    if !last.variadic && len(fs.args) > len(fs.positionals) {
+        n := len(fs.positionals)
+        return &ArgumentError{Value: fs.args[n], Pos: n}
+    }
+
+    for i, p := range fs.positionals {
+        // Keep the existing (default) value of an empty variadic argument.
+        if p.variadic && values[i].Len() == 0 {
+            continue
+        }
+        p.field.Set(values[i])
+    }
+
+    return nil
+}
+
+// Returns a synopsis of the positional arguments, e.g.,
+// "<src> <dst> [files...]", or "" if there are none.
+func (fs *FlagSet) positional_synopsis() string {
+    names := make([]string, len(fs.positionals))
+    for i, p := range fs.positionals {
+        if p.variadic {
+            names[i] = "[" + p.name + "...]"
+        } else {
+            names[i] = "<" + p.name + ">"
+        }
+    }
+
+    return strings.Join(names, " ")
+}
+
+// Prints the list of positional arguments, if any, as part of
+// `PrintDefaults()`.
+func (fs *FlagSet) print_positionals() {
+    if len(fs.positionals) == 0 {
+        return
+    }
+
+    fmt.Fprintf(fs.Output(), "\nArguments: %s\n", fs.positional_synopsis())
+    for _, p := range fs.positionals {
+        if p.usage != "" {
+            fmt.Fprintf(fs.Output(), "  %s\n    \t%s\n", p.name, p.usage)
+        }
+    }
+}
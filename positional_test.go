@@ -0,0 +1,132 @@
+package flagutil_test
+
+import (
+    "bytes"
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+type CopyFlags struct {
+    Force bool `flagutil:"f,usage='Overwrite files'"`
+    Dest string `flagutil:"dest,pos=0,usage='Destination directory'"`
+    Count int `flagutil:"count,pos=1"`
+    Files []string `flagutil:"files,pos=2,usage='Files to copy'"`
+}
+
+func TestPositional(t *testing.T) {
+    tests := []struct {
+        args []string
+        expected CopyFlags
+    }{
+        {[]string{"-f", "out", "3", "a", "b"},
+            CopyFlags{Force: true, Dest: "out", Count: 3,
+                Files: []string{"a", "b"}}},
+        {[]string{"out", "0x10"},
+            CopyFlags{Dest: "out", Count: 16}},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        data := new(CopyFlags)
+        if err := flags.FlagFromStruct(data); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+        if err := flags.Parse(test.args); err != nil {
+            t.Errorf("%v: error parsing flags: %s", test.args, err)
+            continue
+        }
+        if !reflect.DeepEqual(*data, test.expected) {
+            t.Errorf("%v: got %+v, expected %+v", test.args, *data,
+                test.expected)
+        }
+    }
+}
+
+func TestPositionalErrors(t *testing.T) {
+    type TwoArgs struct {
+        Src string `flagutil:"src,pos=0"`
+        Wait time.Duration `flagutil:"wait,pos=1"`
+    }
+
+    tests := []struct {
+        args []string
+        expected flagutil.ArgumentError
+    }{
+        {[]string{"a"}, flagutil.ArgumentError{Name: "wait", Pos: 1}},
+        {[]string{"a", "1s", "b"},
+            flagutil.ArgumentError{Value: "b", Pos: 2}},
+        {[]string{"a", "soon"},
+            flagutil.ArgumentError{Name: "wait", Value: "soon", Pos: 1}},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        data := new(TwoArgs)
+        if err := flags.FlagFromStruct(data); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        var arg_err *flagutil.ArgumentError
+        if !errors.As(err, &arg_err) {
+            t.Errorf("%v: expected an *ArgumentError, got %T: %v", test.args,
+                err, err)
+            continue
+        }
+        arg_err.Err = nil
+        if *arg_err != test.expected {
+            t.Errorf("%v: got %+v, expected %+v", test.args, *arg_err,
+                test.expected)
+        }
+        if data.Src != "" {
+            t.Errorf("%v: Src should not be set on error", test.args)
+        }
+    }
+}
+
+func TestPositionalDeclErrors(t *testing.T) {
+    type Gap struct {
+        A string `flagutil:"a,pos=0"`
+        B string `flagutil:"b,pos=2"`
+    }
+    type VariadicFirst struct {
+        A []string `flagutil:"a,pos=0"`
+        B string `flagutil:"b,pos=1"`
+    }
+    type Duplicate struct {
+        A string `flagutil:"a,pos=0"`
+        B string `flagutil:"b,pos=0"`
+    }
+    type Negative struct {
+        A string `flagutil:"a,pos=-1"`
+    }
+
+    for _, store := range []interface{}{new(Gap), new(VariadicFirst),
+        new(Duplicate), new(Negative)} {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        if err := flags.FlagFromStruct(store); err == nil {
+            t.Errorf("%T: expected an error", store)
+        }
+    }
+}
+
+func TestPositionalUsage(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    buf := new(bytes.Buffer)
+    flags.SetOutput(buf)
+    flags.FlagFromStruct(new(CopyFlags))
+    flags.PrintDefaults()
+
+    want := "Arguments: <dest> <count> [files...]\n" +
+        "  dest\n    \tDestination directory\n" +
+        "  files\n    \tFiles to copy\n"
+    if !strings.Contains(buf.String(), want) {
+        t.Errorf("defaults missing %q:\n%s", want, buf.String())
+    }
+}
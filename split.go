@@ -0,0 +1,220 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Options for splitting a command-line argument into multiple values on the
+// delimiter of a multi-valued flag. The zero value splits on every
+// occurrence of the delimiter and keeps every element, like
+// `strings.Split()`. The options have no effect if there is no delimiter.
+type SplitOptions struct {
+    // Honor quotes and backslash escapes, CSV-style. A delimiter inside
+    // double or single quotes, or preceded by a backslash, is part of the
+    // value, e.g., `a,"b,c",d\,e` with the delimiter "," is split into "a",
+    // "b,c", and "d,e".
+    Quotes bool
+
+    // Trim unquoted whitespace around each element, e.g., "a, b" is split
+    // into "a" and "b".
+    TrimSpace bool
+
+    // What to do with elements that are empty, e.g., the middle of "a,,b".
+    // An element that is quoted, e.g., `""`, is never considered empty.
+    Empty EmptyPolicy
+}
+
+// What to do with empty elements when splitting an argument. See
+// `SplitOptions`.
+type EmptyPolicy int
+
+const (
+    // Empty elements are kept as empty values. This is the default policy.
+    EmptyKeep EmptyPolicy = iota
+
+    // Empty elements are skipped.
+    EmptySkip
+
+    // Empty elements are an error.
+    EmptyError
+)
+
+// Options for the "split" key in a struct tag.
+var split_tag_options = []string{"csv", "trim", "skipempty", "noempty"}
+
+// Returns the `SplitOptions` for the "|"-separated list of options in a
+// "split" struct tag key, e.g., "csv|trim".
+func parse_split_tag(value string) (SplitOptions, error) {
+    var opts SplitOptions
+    seen := map[string]bool{}
+
+    for _, name := range strings.Split(value, "|") {
+        if !contains(split_tag_options, name) {
+            return opts, fmt.Errorf("unknown split option %q", name)
+        }
+        seen[name] = true
+
+        switch name {
+        case "csv":
+            opts.Quotes = true
+        case "trim":
+            opts.TrimSpace = true
+        case "skipempty":
+            opts.Empty = EmptySkip
+        case "noempty":
+            opts.Empty = EmptyError
+        }
+    }
+
+    if seen["skipempty"] && seen["noempty"] {
+        return opts, fmt.Errorf("split options %q and %q conflict",
+            "skipempty", "noempty")
+    }
+
+    return opts, nil
+}
+
+// Splits `val` on `del` (if not "") according to `opts`.
+func split_values(val, del string, opts SplitOptions) ([]string, error) {
+    if del == "" {
+        return []string{val}, nil
+    }
+    if opts == (SplitOptions{}) {
+        return strings.Split(val, del), nil
+    }
+
+    var (
+        parts []string
+        b strings.Builder
+        kept int // Length of b, excluding trailing unquoted whitespace.
+        quoted bool // Whether the current element has a quoted section.
+        quote rune // The open quote character, or 0.
+    )
+
+    end_element := func() error {
+        s := b.String()
+        if opts.TrimSpace {
+            s = s[:kept]
+        }
+        is_quoted := quoted
+        b.Reset()
+        kept = 0
+        quoted = false
+
+        if s == "" && !is_quoted {
+            switch opts.Empty {
+            case EmptySkip:
+                return nil
+            case EmptyError:
+                return fmt.Errorf("empty value in %q", val)
+            }
+        }
+        parts = append(parts, s)
+
+        return nil
+    }
+
+    for i := 0; i < len(val); {
+        r, size := utf8.DecodeRuneInString(val[i:])
+
+        switch {
+        case opts.Quotes && r == '\\':
+            if i + size >= len(val) {
+                return nil, fmt.Errorf("trailing backslash in %q", val)
+            }
+            next, next_size := utf8.DecodeRuneInString(val[i + size:])
+            b.WriteRune(next)
+            kept = b.Len()
+            i += size + next_size
+            continue
+        case quote != 0:
+            if r == quote {
+                quote = 0
+            } else {
+                b.WriteRune(r)
+                kept = b.Len()
+            }
+        case opts.Quotes && (r == '"' || r == '\''):
+            quote = r
+            quoted = true
+        case strings.HasPrefix(val[i:], del):
+            if err := end_element(); err != nil {
+                return nil, err
+            }
+            i += len(del)
+            continue
+        case opts.TrimSpace && unicode.IsSpace(r):
+            // Leading whitespace is dropped here, and trailing whitespace
+            // when the element ends.
+            if b.Len() > 0 || quoted {
+                b.WriteRune(r)
+            }
+        default:
+            b.WriteRune(r)
+            kept = b.Len()
+        }
+
+        i += size
+    }
+
+    if quote != 0 {
+        return nil, fmt.Errorf("unterminated quote in %q", val)
+    }
+    if err := end_element(); err != nil {
+        return nil, err
+    }
+
+    return parts, nil
+}
+
+var quote_replacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// The inverse of `split_values()`: joins `parts` with `del`, quoting
+// elements as needed so that splitting the result gives back `parts`.
+func join_values(parts []string, del string, opts SplitOptions) string {
+    if !opts.Quotes {
+        return strings.Join(parts, del)
+    }
+
+    elems := make([]string, len(parts))
+    for i, part := range parts {
+        if part != "" && !strings.Contains(part, del) &&
+            !strings.ContainsAny(part, `"'\`) &&
+            strings.TrimSpace(part) == part {
+            elems[i] = part
+            continue
+        }
+        elems[i] = `"` + quote_replacer.Replace(part) + `"`
+    }
+
+    return strings.Join(elems, del)
+}
@@ -0,0 +1,163 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "testing"
+)
+
+func TestMultiArgSplit(t *testing.T) {
+    tests := []struct {
+        name string
+        opts flagutil.SplitOptions
+        arg string
+        expected []string
+        fail bool
+    }{
+        {"plain", flagutil.SplitOptions{}, `a, "b,c",,d`,
+            []string{"a", ` "b`, `c"`, "", "d"}, false},
+        {"csv", flagutil.SplitOptions{Quotes: true}, `a,"b,c",'d,"e',f\,g`,
+            []string{"a", "b,c", `d,"e`, "f,g"}, false},
+        {"trim", flagutil.SplitOptions{TrimSpace: true}, " a , b c ,d",
+            []string{"a", "b c", "d"}, false},
+        {"csv trim", flagutil.SplitOptions{Quotes: true, TrimSpace: true},
+            ` a , " b " , c\ `, []string{"a", " b ", "c "}, false},
+        {"skip empty", flagutil.SplitOptions{Quotes: true,
+            Empty: flagutil.EmptySkip}, `a,,"",b,`,
+            []string{"a", "", "b"}, false},
+        {"keep empty", flagutil.SplitOptions{}, "a,,b,",
+            []string{"a", "", "b", ""}, false},
+        {"no empty", flagutil.SplitOptions{Empty: flagutil.EmptyError}, "a,,b",
+            nil, true},
+        {"unterminated quote", flagutil.SplitOptions{Quotes: true}, `a,"b`,
+            nil, true},
+        {"trailing backslash", flagutil.SplitOptions{Quotes: true}, `a,b\`,
+            nil, true},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(st *testing.T) {
+            ma := flagutil.NewMultiArgString(",")
+            ma.Split = test.opts
+
+            err := ma.Set(test.arg)
+            if test.fail {
+                if err == nil {
+                    st.Errorf("expected an error, got %q", ma.Values())
+                }
+                return
+            }
+            if err != nil {
+                st.Fatalf("error setting %q: %s", test.arg, err)
+            }
+            if !reflect.DeepEqual(ma.Values(), test.expected) {
+                st.Errorf("got %q, expected %q", ma.Values(), test.expected)
+            }
+        })
+    }
+}
+
+type SplitFlags struct {
+    Names []string `flagutil:"name,del=',',split='csv|trim',usage='Names'"`
+    Ports []int `flagutil:"port,del=',',split='trim|noempty',usage='Ports'"`
+    Labels map[string]string `flagutil:"label,del=',',split='csv',usage='Labels'"`
+    Modes []string `flagutil:"mode,del=',',split='csv',choices='a,b|c',nocase,maxcount=2,usage='Modes'"`
+}
+
+func TestTagSplit(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    data := new(SplitFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    err := flags.Parse([]string{
+        "-name", `"Smith, J", Doe`,
+        "-port", "80, 443",
+        "-label", `note="x,y",env=prod`,
+        "-mode", `"A,B",C`,
+    })
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+
+    expected := SplitFlags{
+        Names: []string{"Smith, J", "Doe"},
+        Ports: []int{80, 443},
+        Labels: map[string]string{"note": "x,y", "env": "prod"},
+        Modes: []string{"a,b", "c"},
+    }
+    if !reflect.DeepEqual(*data, expected) {
+        t.Errorf("got %+v, expected %+v", *data, expected)
+    }
+
+    flags = flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    if err := flags.FlagFromStruct(new(SplitFlags)); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    for _, args := range [][]string{
+        {"-port", "80,,443"},
+        {"-name", `"Smith`},
+        {"-mode", `"a,b",c,a`},
+    } {
+        if err := flags.Parse(args); err == nil {
+            t.Errorf("expected an error for %q", args)
+        }
+    }
+}
+
+func TestTagSplitErrors(t *testing.T) {
+    tests := map[string]interface{}{
+        "unknown option": &struct {
+            Names []string `flagutil:"name,del=',',split='csv|quoted'"`
+        }{},
+        "conflicting options": &struct {
+            Names []string `flagutil:"name,del=',',split='skipempty|noempty'"`
+        }{},
+    }
+
+    for name, data := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            err := flags.FlagFromStruct(data)
+
+            var tag_err *flagutil.TagError
+            if !errors.As(err, &tag_err) {
+                st.Errorf("expected a *TagError, got %v", err)
+            }
+        })
+    }
+}
+
+func TestSetSplit(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+
+    var names []string
+    var count int
+    if err := flags.FlagSep(&names, "name", "Names", ","); err != nil {
+        t.Fatalf("error adding flag: %s", err)
+    }
+    if err := flags.Flag(&count, "count", "Count"); err != nil {
+        t.Fatalf("error adding flag: %s", err)
+    }
+
+    err := flags.SetSplit("name", flagutil.SplitOptions{Quotes: true})
+    if err != nil {
+        t.Fatalf("error setting split options: %s", err)
+    }
+    if err := flags.SetSplit("count", flagutil.SplitOptions{}); err == nil {
+        t.Errorf("expected an error for a flag that is not multi-valued")
+    }
+
+    if err := flags.Parse([]string{"-name", `a,"b,c"`}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if expected := []string{"a", "b,c"}; !reflect.DeepEqual(names, expected) {
+        t.Errorf("got %q, expected %q", names, expected)
+    }
+}
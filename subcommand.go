@@ -0,0 +1,167 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "fmt"
+    "reflect"
+)
+
+// A subcommand declared by a struct field tagged with "cmd".
+type subcommand struct {
+    name string
+    usage string
+    flags *FlagSet
+    field reflect.Value // The struct field, a struct or pointer to one.
+    store reflect.Value // Pointer to the struct bound to `flags`.
+}
+
+// Declares a subcommand named `name` whose flags are taken from the struct
+// (or pointer to a struct) in `field`. If `field` is a nil pointer, a new
+// struct is bound to the subcommand's flags, and `field` is only set to
+// point to it if the subcommand is selected.
+func (fs *FlagSet) add_subcommand(
+    field reflect.Value,
+    name, usage string,
+) error {
+    if fs.Subcommand(name) != nil {
+        return fmt.Errorf("subcommand %q redefined", name)
+    }
+
+    var store reflect.Value
+    switch {
+    case field.Kind() == reflect.Struct:
+        store = field.Addr()
+    case field.Kind() == reflect.Ptr &&
+        field.Type().Elem().Kind() == reflect.Struct:
+        store = field
+        if field.IsNil() {
+            store = reflect.New(field.Type().Elem())
+        }
+    default:
+        return unsupported_type_error(name, field.Type(),
+            fmt.Errorf("subcommands must be a struct or pointer to a struct"))
+    }
+
+    sub := &subcommand{
+        name: name,
+        usage: usage,
+        flags: NewFlagSet(fs.name + " " + name, ContinueOnError),
+        field: field,
+        store: store,
+    }
+    sub.flags.Usage = func() {
+        fmt.Fprintf(sub.flags.Output(), "Usage of %s:\n", sub.flags.name)
+        sub.flags.PrintDefaults()
+    }
+
+    if err := sub.flags.FlagFromStruct(store.Interface()); err != nil {
+        return err
+    }
+    fs.subcommands = append(fs.subcommands, sub)
+
+    return nil
+}
+
+// Returns the FlagSet for the subcommand `name`, or nil if there is no such
+// subcommand.
+func (fs *FlagSet) Subcommand(name string) *FlagSet {
+    for _, sub := range fs.subcommands {
+        if sub.name == name {
+            return sub.flags
+        }
+    }
+
+    return nil
+}
+
+// Returns the name of the subcommand selected by `Parse()`, or "" if no
+// subcommand was given. Use `Subcommand()` to get its FlagSet, e.g., to find
+// out whether it selected a subcommand of its own.
+func (fs *FlagSet) Selected() string {
+    if fs.selected == nil {
+        return ""
+    }
+
+    return fs.selected.name
+}
+
+// Selects and parses the subcommand named by the first remaining argument,
+// if any. Afterwards, `Args()` returns the arguments left over by the
+// subcommand.
+func (fs *FlagSet) run_subcommand() error {
+    fs.selected = nil
+    if len(fs.args) == 0 {
+        return nil
+    }
+
+    var sub *subcommand
+    for _, s := range fs.subcommands {
+        if s.name == fs.args[0] {
+            sub = s
+            break
+        }
+    }
+    if sub == nil {
+        return fs.report_error(&CommandError{
+            Command: fs.name,
+            Name: fs.args[0],
+        })
+    }
+
+    sub.flags.SetOutput(fs.Output())
+    sub.flags.syntax = fs.syntax
+    sub.flags.interspersed = fs.interspersed
+    if sub.flags.env_prefix == "" {
+        sub.flags.env_prefix = fs.env_prefix
+    }
+
+    // Errors have already been reported by the subcommand.
+    if err := sub.flags.parse(fs.args[1:]); err != nil {
+        return err
+    }
+
+    fs.selected = sub
+    if sub.field.Kind() == reflect.Ptr {
+        sub.field.Set(sub.store)
+    }
+    fs.args = sub.flags.Args()
+
+    return nil
+}
+
+// Prints the list of subcommands, if any, as part of `PrintDefaults()`.
+func (fs *FlagSet) print_subcommands() {
+    if len(fs.subcommands) == 0 {
+        return
+    }
+
+    fmt.Fprintf(fs.Output(), "\nCommands:\n")
+    for _, sub := range fs.subcommands {
+        fmt.Fprintf(fs.Output(), "  %s\n    \t%s\n", sub.name, sub.usage)
+    }
+}
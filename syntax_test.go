@@ -0,0 +1,224 @@
+package flagutil_test
+
+import (
+    "bytes"
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type GNUFlags struct {
+    Verbose bool `flagutil:"verbose,short='v',usage='Verbose output'"`
+    Extract bool `flagutil:"x,usage='Extract'"`
+    Output string `flagutil:"output,short='o',usage='Output file'"`
+    Level int `flagutil:"level,usage='Level'"`
+    Tags []string `flagutil:"tag,short='t',usage='Tags'"`
+}
+
+func new_gnu_flags() (*flagutil.FlagSet, *GNUFlags) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.SetSyntax(flagutil.GNUSyntax)
+    data := new(GNUFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        panic(err)
+    }
+
+    return flags, data
+}
+
+func TestGNUSyntax(t *testing.T) {
+    tests := []struct {
+        args []string
+        expected GNUFlags
+        rest []string
+    }{
+        {[]string{"-vx", "-ofile", "a"},
+            GNUFlags{Verbose: true, Extract: true, Output: "file"},
+            []string{"a"}},
+        {[]string{"-v", "-x", "-o", "file", "--", "-a"},
+            GNUFlags{Verbose: true, Extract: true, Output: "file"},
+            []string{"-a"}},
+        {[]string{"--verbose", "--output=file", "--level", "3"},
+            GNUFlags{Verbose: true, Output: "file", Level: 3},
+            []string{}},
+        {[]string{"-vofile", "-t", "a", "--tag=b", "-tc"},
+            GNUFlags{Verbose: true, Output: "file",
+                Tags: []string{"a", "b", "c"}},
+            []string{}},
+        {[]string{"--verbose=false", "-", "b"},
+            GNUFlags{},
+            []string{"-", "b"}},
+    }
+
+    for _, test := range tests {
+        flags, data := new_gnu_flags()
+        if err := flags.Parse(test.args); err != nil {
+            t.Errorf("%v: error parsing flags: %s", test.args, err)
+            continue
+        }
+        if !reflect.DeepEqual(*data, test.expected) {
+            t.Errorf("%v: got %+v, expected %+v", test.args, *data,
+                test.expected)
+        }
+        if !reflect.DeepEqual(flags.Args(), test.rest) {
+            t.Errorf("%v: got args %v, expected %v", test.args, flags.Args(),
+                test.rest)
+        }
+    }
+}
+
+func TestGNUSyntaxErrors(t *testing.T) {
+    var unknown *flagutil.UnknownFlagError
+    var missing *flagutil.MissingValueError
+    var syntax *flagutil.FlagSyntaxError
+
+    tests := []struct {
+        args []string
+        target interface{}
+        flag string
+    }{
+        {[]string{"-vq"}, &unknown, "q"},
+        {[]string{"-level", "3"}, &unknown, "l"},
+        {[]string{"--v"}, &unknown, "v"},
+        {[]string{"-vo"}, &missing, "output"},
+        {[]string{"---verbose"}, &syntax, ""},
+    }
+
+    for _, test := range tests {
+        flags, _ := new_gnu_flags()
+        err := flags.Parse(test.args)
+        if !errors.As(err, test.target) {
+            t.Errorf("%v: expected %T, got %T: %v", test.args, test.target,
+                err, err)
+            continue
+        }
+
+        var flag_err *flagutil.FlagError
+        switch e := reflect.ValueOf(test.target).Elem().Interface().(type) {
+        case *flagutil.UnknownFlagError:
+            flag_err = &e.FlagError
+        case *flagutil.MissingValueError:
+            flag_err = &e.FlagError
+        case *flagutil.FlagSyntaxError:
+            flag_err = &e.FlagError
+        }
+        if flag_err.Flag != test.flag {
+            t.Errorf("%v: got flag %q, expected %q", test.args, flag_err.Flag,
+                test.flag)
+        }
+    }
+}
+
+func TestShortAliasGoSyntax(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    var verbose bool
+    if err := flags.FlagShort(&verbose, "verbose", "Verbose", "v"); err != nil {
+        t.Fatalf("error adding flag: %s", err)
+    }
+    if err := flags.Parse([]string{"-v"}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    if !verbose {
+        t.Errorf("verbose not set")
+    }
+
+    var quiet bool
+    if err := flags.FlagShort(&quiet, "quiet", "Quiet", "v"); err == nil {
+        t.Errorf("expected an error for a duplicate short name")
+    }
+    if err := flags.FlagShort(&quiet, "quiet", "Quiet", "qq"); err == nil {
+        t.Errorf("expected an error for a multi-character short name")
+    }
+
+    // Short names and flag names can't clash, in either order.
+    var x, extra bool
+    if err := flags.Flag(&x, "x", "X"); err != nil {
+        t.Fatalf("error adding flag: %s", err)
+    }
+    if err := flags.FlagShort(&extra, "extra", "Extra", "x"); err == nil {
+        t.Errorf("expected an error for a short name used as a flag name")
+    }
+    var v bool
+    if err := flags.Flag(&v, "v", "V"); err == nil {
+        t.Errorf("expected an error for a flag name used as a short name")
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Errorf("expected Var() to panic for a short name")
+        }
+    }()
+    flags.Var(flagutil.NewMultiArgString(","), "v", "V")
+}
+
+func TestGNUPrintDefaults(t *testing.T) {
+    flags, _ := new_gnu_flags()
+    buf := new(bytes.Buffer)
+    flags.SetOutput(buf)
+    flags.PrintDefaults()
+
+    for _, want := range []string{"  -v, --verbose\n", "  -x\t",
+        "  -o, --output string\n", "  --level int\n"} {
+        if !strings.Contains(buf.String(), want) {
+            t.Errorf("defaults missing %q:\n%s", want, buf.String())
+        }
+    }
+}
+
+func TestInterspersed(t *testing.T) {
+    tests := []struct {
+        syntax flagutil.Syntax
+        args []string
+        rest []string
+    }{
+        {flagutil.GoSyntax, []string{"file1", "-v", "file2", "-level", "2"},
+            []string{"file1", "file2"}},
+        {flagutil.GoSyntax, []string{"file1", "-v", "--", "-level", "2"},
+            []string{"file1", "-level", "2"}},
+        {flagutil.GNUSyntax, []string{"a", "-v", "-", "--level=2", "b"},
+            []string{"a", "-", "b"}},
+        {flagutil.GNUSyntax, []string{"-v", "--level", "2"},
+            []string{}},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        flags.SetSyntax(test.syntax)
+        flags.SetInterspersed(true)
+        var verbose bool
+        var level int
+        flags.FlagShort(&verbose, "verbose", "Verbose", "v")
+        flags.Flag(&level, "level", "Level")
+
+        if err := flags.Parse(test.args); err != nil {
+            t.Errorf("%v: error parsing flags: %s", test.args, err)
+            continue
+        }
+        if !verbose {
+            t.Errorf("%v: verbose not set", test.args)
+        }
+        if !reflect.DeepEqual(flags.Args(), test.rest) {
+            t.Errorf("%v: got args %v, expected %v", test.args, flags.Args(),
+                test.rest)
+        }
+    }
+
+    // Without interspersed arguments, flags stop at the first non-flag
+    // argument.
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    var verbose bool
+    flags.Flag(&verbose, "v", "Verbose")
+    flags.Parse([]string{"file1", "-v"})
+    if verbose {
+        t.Errorf("verbose should not be set")
+    }
+    if !reflect.DeepEqual(flags.Args(), []string{"file1", "-v"}) {
+        t.Errorf("got args %v, expected [file1 -v]", flags.Args())
+    }
+}
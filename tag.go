@@ -0,0 +1,392 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    textparser "github.com/cuberat/go-textparser"
+)
+
+type tag_data struct {
+    flag_name string
+    delimiter string
+    usage_string string
+    layout string
+    kv_separator string
+    dup_keys string
+    env string
+    prefix string
+    short string
+    required bool
+    choices []string
+    ignore_case bool
+    constraints [][2]string // Constraint names and limits.
+    default_value string
+    has_default bool
+    group string
+    exclusive bool
+    at_least_one bool
+    requires []string
+    slice_policy SlicePolicy
+    split SplitOptions
+    position int // -1 if not a positional argument.
+    command bool
+}
+
+// Supported keys in a `flagutil` struct tag, mapped to whether the key takes
+// a value. Keys that do not take a value are flags, e.g., "required".
+var tag_keys = map[string]bool{
+    "atleastone": false,
+    "choices": true,
+    "cmd": false,
+    "default": true,
+    "del": true,
+    "dupkeys": true,
+    "env": true,
+    "exclusive": false,
+    "group": true,
+    "kvsep": true,
+    "layout": true,
+    "max": true,
+    "maxcount": true,
+    "maxlen": true,
+    "min": true,
+    "mincount": true,
+    "minlen": true,
+    "nocase": false,
+    "pattern": true,
+    "pos": true,
+    "prefix": true,
+    "required": false,
+    "requires": true,
+    "short": true,
+    "slice": true,
+    "split": true,
+    "usage": true,
+}
+
+// Keys whose values must be non-negative integers.
+var tag_int_keys = []string{"pos", "minlen", "maxlen", "mincount", "maxcount"}
+
+// Keys that declare constraints on the values of a flag, in the order they
+// are applied. See `FlagSet.SetConstraint()`.
+var constraint_keys = []string{"min", "max", "minlen", "maxlen", "pattern",
+    "mincount", "maxcount"}
+
+// Allowed values for keys that only accept certain values.
+var tag_values = map[string][]string{
+    "dupkeys": {"last", "error"},
+    "slice": {"replace", "append"},
+}
+
+// Kinds of pieces a tag is broken into by `scan_tag()`.
+const (
+    tag_piece_word = iota
+    tag_piece_string
+    tag_piece_space
+    tag_piece_comma
+    tag_piece_equals
+)
+
+type tag_piece struct {
+    kind int
+    text string
+    column int
+}
+
+// Breaks `tag_str` into pieces. Runs of symbols produced by the scanner are
+// split into individual characters, so that, e.g., "=-5" is seen as "=",
+// "-", "5".
+func scan_tag(tag_str string) ([]*tag_piece, error) {
+    p := textparser.NewScannerString(tag_str)
+    p.SkipWhitespace = false
+
+    pieces := []*tag_piece{}
+    for p.Scan() {
+        token := p.Token()
+        column := p.Position().Column
+
+        switch token.Type {
+        case textparser.TokenTypeWhitespace:
+            pieces = append(pieces,
+                &tag_piece{tag_piece_space, token.Text, column})
+        case textparser.TokenTypeString:
+            runes := []rune(token.Text)
+            text := string(runes[1:len(runes) - 1])
+            pieces = append(pieces,
+                &tag_piece{tag_piece_string, text, column})
+        case textparser.TokenTypeSymbol:
+            for i, ch := range []rune(token.Text) {
+                kind := tag_piece_word
+                switch ch {
+                case ',':
+                    kind = tag_piece_comma
+                case '=':
+                    kind = tag_piece_equals
+                }
+                pieces = append(pieces,
+                    &tag_piece{kind, string(ch), column + i})
+            }
+        default:
+            pieces = append(pieces,
+                &tag_piece{tag_piece_word, token.Text, column})
+        }
+    }
+
+    if err := p.Err(); err != nil && err != io.EOF {
+        return nil, &TagError{
+            Tag: tag_str,
+            Column: p.Position().Column,
+            Expected: "closing quote",
+            Err: err,
+        }
+    }
+
+    return pieces, nil
+}
+
+// Parses a `flagutil` struct tag. The first element is the flag name,
+// followed by comma-separated key='value' pairs. Returns nil if the tag is
+// empty. Errors are returned as a `*TagError` with the `Column`, `Expected`,
+// and `Err` fields filled in.
+func parse_tag(tag_str string) (*tag_data, error) {
+    if tag_str == "" {
+        return nil, nil
+    }
+
+    pieces, err := scan_tag(tag_str)
+    if err != nil {
+        return nil, err
+    }
+
+    idx := 0
+    end_column := len([]rune(tag_str)) + 1
+
+    fail := func(expected string) error {
+        column := end_column
+        found := "end of tag"
+        if idx < len(pieces) {
+            column = pieces[idx].column
+            found = fmt.Sprintf("%q", pieces[idx].text)
+        }
+        return &TagError{
+            Tag: tag_str,
+            Column: column,
+            Expected: expected,
+            Err: fmt.Errorf("expected %s, found %s", expected, found),
+        }
+    }
+
+    skip_space := func() {
+        for idx < len(pieces) && pieces[idx].kind == tag_piece_space {
+            idx++
+        }
+    }
+
+    // Reads a word (possibly made up of several adjacent pieces, e.g.,
+    // "dry-run") or a quoted string.
+    read_word := func(allow_string bool) (string, bool) {
+        if idx >= len(pieces) {
+            return "", false
+        }
+        if allow_string && pieces[idx].kind == tag_piece_string {
+            idx++
+            return pieces[idx - 1].text, true
+        }
+
+        b := new(strings.Builder)
+        for idx < len(pieces) && pieces[idx].kind == tag_piece_word {
+            b.WriteString(pieces[idx].text)
+            idx++
+        }
+
+        return b.String(), b.Len() > 0
+    }
+
+    // Expects the end of the tag or a comma separating elements.
+    end_of_element := func() (bool, error) {
+        skip_space()
+        if idx >= len(pieces) {
+            return true, nil
+        }
+        if pieces[idx].kind != tag_piece_comma {
+            return false, fail(`","`)
+        }
+        idx++
+
+        return false, nil
+    }
+
+    skip_space()
+    name_idx := idx
+    name, ok := read_word(true)
+    if !ok || name == "" || strings.HasPrefix(name, "-") ||
+        strings.Contains(name, "=") {
+        idx = name_idx
+        return nil, fail("flag name")
+    }
+
+    fields := map[string]string{"name": name}
+
+    done, err := end_of_element()
+    if err != nil {
+        return nil, err
+    }
+
+    for !done {
+        skip_space()
+        key_idx := idx
+        key, ok := read_word(false)
+        if !ok {
+            return nil, fail("key")
+        }
+
+        if _, ok := tag_keys[key]; !ok {
+            idx = key_idx
+            return nil, fail("one of " + list_tag_keys())
+        }
+        if _, ok := fields[key]; ok {
+            idx = key_idx
+            return nil, fail("key not already specified")
+        }
+
+        if !tag_keys[key] {
+            fields[key] = ""
+            done, err = end_of_element()
+            if err != nil {
+                return nil, err
+            }
+            continue
+        }
+
+        skip_space()
+        if idx >= len(pieces) || pieces[idx].kind != tag_piece_equals {
+            return nil, fail(fmt.Sprintf(`"=" after key %q`, key))
+        }
+        idx++
+
+        skip_space()
+        value_idx := idx
+        value, ok := read_word(true)
+        if !ok {
+            return nil, fail(fmt.Sprintf("value for key %q", key))
+        }
+        if allowed, ok := tag_values[key]; ok && !contains(allowed, value) {
+            idx = value_idx
+            return nil, fail(fmt.Sprintf("one of %s for key %q",
+                strings.Join(allowed, ", "), key))
+        }
+        if contains(tag_int_keys, key) {
+            if n, err := strconv.Atoi(value); err != nil || n < 0 {
+                idx = value_idx
+                return nil, fail(fmt.Sprintf(
+                    "non-negative integer for key %q", key))
+            }
+        }
+        if key == "split" {
+            if _, err := parse_split_tag(value); err != nil {
+                idx = value_idx
+                return nil, fail(fmt.Sprintf("options from %s, separated " +
+                    "by \"|\", for key %q", strings.Join(split_tag_options,
+                    ", "), key))
+            }
+        }
+        fields[key] = value
+
+        done, err = end_of_element()
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    tag_info := &tag_data{
+        flag_name: fields["name"],
+        delimiter: fields["del"],
+        usage_string: fields["usage"],
+        layout: fields["layout"],
+        kv_separator: fields["kvsep"],
+        dup_keys: fields["dupkeys"],
+        env: fields["env"],
+        prefix: fields["prefix"],
+        short: fields["short"],
+        position: -1,
+    }
+    if pos, ok := fields["pos"]; ok {
+        tag_info.position, _ = strconv.Atoi(pos)
+    }
+    _, tag_info.command = fields["cmd"]
+    _, tag_info.required = fields["required"]
+    _, tag_info.ignore_case = fields["nocase"]
+    for _, key := range constraint_keys {
+        if limit, ok := fields[key]; ok {
+            tag_info.constraints = append(tag_info.constraints,
+                [2]string{key, limit})
+        }
+    }
+    tag_info.default_value, tag_info.has_default = fields["default"]
+    tag_info.group = fields["group"]
+    if fields["slice"] == "append" {
+        tag_info.slice_policy = SliceAppend
+    }
+    if split, ok := fields["split"]; ok {
+        tag_info.split, _ = parse_split_tag(split)
+    }
+    _, tag_info.exclusive = fields["exclusive"]
+    _, tag_info.at_least_one = fields["atleastone"]
+    if requires, ok := fields["requires"]; ok {
+        tag_info.requires = strings.Split(requires, "|")
+    }
+    if choices, ok := fields["choices"]; ok {
+        tag_info.choices = strings.Split(choices, "|")
+    }
+
+    return tag_info, nil
+}
+
+func list_tag_keys() string {
+    keys := make([]string, 0, len(tag_keys))
+    for key := range tag_keys {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    return strings.Join(keys, ", ")
+}
+
+func contains(list []string, s string) bool {
+    for _, elem := range list {
+        if elem == s {
+            return true
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,137 @@
+package flagutil_test
+
+import (
+    "errors"
+    flagutil "github.com/cuberat/go-flagutil"
+    "testing"
+)
+
+type TagTypo struct {
+    Name string `flagutil:"name, dell=','"`
+}
+
+type TagNoEquals struct {
+    Name string `flagutil:"name,usage 'Usage'"`
+}
+
+type TagNoValue struct {
+    Name string `flagutil:"name,usage="`
+}
+
+type TagNoName struct {
+    Name string `flagutil:",usage='Usage'"`
+}
+
+type TagUnterminated struct {
+    Name string `flagutil:"name,usage='Usage"`
+}
+
+type TagDuplicate struct {
+    Name string `flagutil:"name,usage='a',usage='b'"`
+}
+
+type TagDashName struct {
+    Name string `flagutil:"-name,usage='Usage'"`
+}
+
+type TagEmptyName struct {
+    Name string `flagutil:"'',usage='Usage'"`
+}
+
+type TagEqualsName struct {
+    Name string `flagutil:"'a=b',usage='Usage'"`
+}
+
+type TagHyphenated struct {
+    DryRun bool `flagutil:"dry-run, usage = 'Do nothing'"`
+}
+
+func TestTagErrors(t *testing.T) {
+    type tag_test struct {
+        store interface{}
+        column int
+    }
+
+    tests := map[string]*tag_test{
+        "unknown_key": &tag_test{&TagTypo{}, 7},
+        "no_equals": &tag_test{&TagNoEquals{}, 12},
+        "no_value": &tag_test{&TagNoValue{}, 12},
+        "no_name": &tag_test{&TagNoName{}, 1},
+        "unterminated": &tag_test{&TagUnterminated{}, 12},
+        "duplicate": &tag_test{&TagDuplicate{}, 15},
+        "dash_name": &tag_test{&TagDashName{}, 1},
+        "empty_name": &tag_test{&TagEmptyName{}, 1},
+        "equals_name": &tag_test{&TagEqualsName{}, 1},
+    }
+
+    for name, this_test := range tests {
+        t.Run(name, func(st *testing.T) {
+            flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+            err := flags.FlagFromStruct(this_test.store)
+
+            var tag_err *flagutil.TagError
+            if !errors.As(err, &tag_err) {
+                st.Errorf("expected a *TagError, got %T: %v", err, err)
+                return
+            }
+
+            if tag_err.Field != "Name" {
+                st.Errorf("wrong field. Got %q, expected %q", tag_err.Field,
+                    "Name")
+            }
+            if tag_err.Column != this_test.column {
+                st.Errorf("wrong column. Got %d, expected %d (%s)",
+                    tag_err.Column, this_test.column, err)
+            }
+            if tag_err.Expected == "" {
+                st.Errorf("missing Expected in error: %s", err)
+            }
+        })
+    }
+}
+
+func TestTagHyphenatedName(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(TagHyphenated)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Errorf("error adding flags: %s", err)
+        return
+    }
+
+    if err := flags.Parse([]string{"-dry-run"}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+        return
+    }
+
+    if !data.DryRun {
+        t.Errorf("flag -dry-run not set")
+    }
+}
+
+type TagSkippedInner struct {
+    Inner string `flagutil:"inner,usage='Inner'"`
+}
+
+type TagSkipped struct {
+    TagSkippedInner `flagutil:"-"`
+    Name string `flagutil:"name,usage='Name'"`
+    Secret string `flagutil:"-"`
+    // Tags on unexported fields are not parsed.
+    private string `flagutil:"private,usage='Unterminated"`
+}
+
+func TestTagSkip(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    if err := flags.FlagFromStruct(new(TagSkipped)); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    for _, name := range []string{"-", "inner", "Secret", "private"} {
+        if flags.GetFlagSet().Lookup(name) != nil {
+            t.Errorf("flag %q defined for a skipped field", name)
+        }
+    }
+    if flags.GetFlagSet().Lookup("name") == nil {
+        t.Errorf("flag %q not defined", "name")
+    }
+}
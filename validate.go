@@ -0,0 +1,579 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice,
+//   this list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package flagutil
+
+import (
+    "flag"
+    "fmt"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Checks a command-line argument for a flag before it is set. Returns the
+// value to set, which may differ from the argument, e.g., to use the
+// canonical spelling of a choice.
+type check_func func(value string) (string, error)
+
+type value_check struct {
+    name string
+    check check_func
+}
+
+// Wraps a flag.Value to check values before they are set. Checks are applied
+// to values from any source, i.e., the command line, the environment, or a
+// config file.
+type checked_value struct {
+    flag.Value
+    checks []*value_check
+}
+
+func (v *checked_value) Set(s string) error {
+    // The reset token for a slice flag is not a value.
+    if _, ok := v.Value.(*slice_value); ok && s == "" {
+        return v.Value.Set(s)
+    }
+
+    for _, c := range v.checks {
+        var err error
+        if s, err = c.check(s); err != nil {
+            return err
+        }
+    }
+
+    return v.Value.Set(s)
+}
+
+func (v *checked_value) IsBoolFlag() bool {
+    bf, ok := v.Value.(bool_flag)
+    return ok && bf.IsBoolFlag()
+}
+
+func (v *checked_value) Get() interface{} {
+    if getter, ok := v.Value.(flag.Getter); ok {
+        return getter.Get()
+    }
+    return nil
+}
+
+// Returns the flag.Value wrapped by a `checked_value`, `slice_value`, or
+// `numeric_value`, if any.
+func unwrap_value(value flag.Value) flag.Value {
+    for {
+        switch v := value.(type) {
+        case *checked_value:
+            value = v.Value
+        case *slice_value:
+            value = v.Value
+        case *numeric_value:
+            value = v.Value
+        default:
+            return value
+        }
+    }
+}
+
+// Returns a copy of `f` with its value unwrapped, so that functions such as
+// `flag.UnquoteUsage()` see the original type.
+func unwrap_flag(f *flag.Flag) *flag.Flag {
+    unwrapped := *f
+    unwrapped.Value = unwrap_value(f.Value)
+
+    return &unwrapped
+}
+
+// Adds a check, identified by `check_name`, for the flag `name`, replacing
+// any existing check with the same name. If `per_value` is true and the flag
+// is a slice with a delimiter, each of the values in an argument is checked
+// separately.
+func (fs *FlagSet) add_check(
+    name, check_name string,
+    per_value bool,
+    check check_func,
+) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+
+    f := fs.flag_flagset.Lookup(name)
+    cv, ok := f.Value.(*checked_value)
+    if !ok {
+        cv = &checked_value{Value: f.Value}
+        f.Value = cv
+    }
+
+    each := func(s string) (string, error) {
+        del := spec.opts.delimiter
+        if !per_value || !is_slice_flag(spec) || del == "" {
+            return check(s)
+        }
+
+        parts, err := split_values(s, del, spec.opts.split)
+        if err != nil {
+            return "", err
+        }
+        if len(parts) == 0 {
+            // Every element was skipped; an empty result would be taken as
+            // the reset token.
+            return s, nil
+        }
+        for i, part := range parts {
+            if parts[i], err = check(part); err != nil {
+                return "", err
+            }
+        }
+        return join_values(parts, del, spec.opts.split), nil
+    }
+
+    for _, c := range cv.checks {
+        if c.name == check_name {
+            c.check = each
+            return nil
+        }
+    }
+    cv.checks = append(cv.checks, &value_check{check_name, each})
+
+    return nil
+}
+
+// Returns the type of the variable the flag is bound to, or nil if unknown,
+// e.g., for flags defined via `Var()`.
+func (spec *flag_spec) store_type() reflect.Type {
+    if spec.val_ptr == nil {
+        return nil
+    }
+
+    t := reflect.TypeOf(spec.val_ptr)
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+
+    return t
+}
+
+// Reports whether the flag is bound to a slice that accepts several values.
+func is_slice_flag(spec *flag_spec) bool {
+    t := spec.store_type()
+    return t != nil && t.Kind() == reflect.Slice &&
+        unmarshaler_parse_func(t) == nil
+}
+
+// Reports whether the flag holds a string, or a slice of strings.
+func (fs *FlagSet) is_string_flag(spec *flag_spec) bool {
+    t := spec.store_type()
+    if t == nil {
+        return is_string_value(fs.flag_flagset.Lookup(spec.name))
+    }
+    if is_slice_flag(spec) {
+        t = t.Elem()
+    }
+
+    return t.Kind() == reflect.String
+}
+
+// Restricts the values of the string (or []string) flag `name` to
+// `choices`. If `ignore_case` is true, values are matched ignoring case,
+// and the flag is set to the matching choice as given in `choices`. This is
+// equivalent to the "choices" and "nocase" keys in a struct tag.
+func (fs *FlagSet) SetChoices(
+    name string,
+    choices []string,
+    ignore_case bool,
+) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    if !fs.is_string_flag(spec) {
+        return fmt.Errorf("choices are only supported for string flags, " +
+            "not -%s", name)
+    }
+    spec.opts.choices = choices
+    spec.opts.ignore_case = ignore_case
+
+    return fs.add_check(name, "choices", true, func(s string) (string, error) {
+        for _, choice := range choices {
+            if s == choice || ignore_case && strings.EqualFold(s, choice) {
+                return choice, nil
+            }
+        }
+        return "", fmt.Errorf("must be one of %s",
+            strings.Join(choices, ", "))
+    })
+}
+
+// Marks the flag `name` as required. `Parse()` returns an error, wrapping a
+// `*RequiredFlagError`, if a required flag was not set on the command line,
+// from the environment, or from a config file. This is equivalent to the
+// "required" key in a struct tag.
+func (fs *FlagSet) MarkRequired(name string) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    spec.opts.required = true
+
+    return nil
+}
+
+// Checks the flags once all sources have been applied.
+func (fs *FlagSet) validate() error {
+    set := fs.set_flags()
+
+    // Required persistent flags are checked by the child command, if one is
+    // selected, since they may be given after its name.
+    deferred := fs.selects_command != nil && fs.selects_command(fs.args)
+
+    missing := []string{}
+    fs.flag_flagset.VisitAll(func(f *flag.Flag) {
+        spec, ok := fs.specs[f.Name]
+        if ok && spec.opts.required && !set[f.Name] &&
+            !(deferred && fs.persistent[f.Name]) {
+            missing = append(missing, f.Name)
+        }
+    })
+    if len(missing) > 0 {
+        return &RequiredFlagError{Flags: missing}
+    }
+
+    if err := fs.validate_groups(set, deferred); err != nil {
+        return err
+    }
+
+    var err error
+    fs.flag_flagset.VisitAll(func(f *flag.Flag) {
+        spec, ok := fs.specs[f.Name]
+        if err != nil || !ok || spec.opts.min_count == 0 {
+            return
+        }
+        count := reflect.ValueOf(spec.val_ptr).Elem().Len()
+        if count < spec.opts.min_count {
+            err = &ConstraintError{
+                Flag: f.Name,
+                Constraint: "mincount",
+                Limit: strconv.Itoa(spec.opts.min_count),
+            }
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    fs.flag_flagset.Visit(func(f *flag.Flag) {
+        spec, ok := fs.specs[f.Name]
+        if err != nil || !ok {
+            return
+        }
+        for _, validator := range spec.validators {
+            if v_err := validator(spec.value(f)); v_err != nil {
+                err = &InvalidValueError{FlagError{Flag: f.Name,
+                    Value: f.Value.String(), Pos: -1, Err: v_err}}
+                return
+            }
+        }
+    })
+
+    return err
+}
+
+// Adds a function to validate the value of the flag `name` after parsing.
+// Validators are called, in the order they were added, if the flag was set
+// on the command line, from the environment, or from a config file. The
+// argument is the value of the variable the flag is bound to, e.g., an int
+// for a flag defined with a pointer to an int, or a []string for a slice.
+// For flags defined via `Var()`, it is the result of `Get()` if the value
+// implements `flag.Getter`, or the flag.Value itself otherwise.
+//
+// An error returned by a validator is returned from `Parse()` as an
+// `*InvalidValueError` for the flag, wrapped in a `*ParseError`.
+func (fs *FlagSet) AddValidator(
+    name string,
+    validator func(value interface{}) error,
+) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+    spec.validators = append(spec.validators, validator)
+
+    return nil
+}
+
+// Returns the current value of the flag, as passed to validators.
+func (spec *flag_spec) value(f *flag.Flag) interface{} {
+    if spec.val_ptr != nil {
+        if _, ok := spec.val_ptr.(flag.Value); !ok {
+            return reflect.ValueOf(spec.val_ptr).Elem().Interface()
+        }
+    }
+
+    value := unwrap_value(f.Value)
+    if getter, ok := value.(flag.Getter); ok {
+        return getter.Get()
+    }
+
+    return value
+}
+
+// Implemented by structs passed to `FlagFromStruct()` that check the values
+// of their fields after parsing. See `FlagFromStruct()`.
+type validator interface {
+    Validate() error
+}
+
+// Calls the `Validate()` methods of the structs passed to
+// `FlagFromStruct()`.
+func (fs *FlagSet) validate_structs() error {
+    for _, v := range fs.struct_validators {
+        if err := v.Validate(); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Returns the number of values that the slice flag with the value `value`
+// keeps when another value is given: those given since the last reset
+// token, plus the default under `SliceAppend` if there was no reset.
+func (spec *flag_spec) kept_count(value flag.Value) int {
+    if cv, ok := value.(*checked_value); ok {
+        value = cv.Value
+    }
+    sv, ok := value.(*slice_value)
+    if !ok {
+        return 0
+    }
+
+    count := sv.count() - sv.start
+    if spec.opts.slice_policy == SliceAppend && !sv.reset {
+        count += reflect.ValueOf(spec.val_ptr).Elem().Len()
+    }
+
+    return count
+}
+
+// Adds a constraint on the values of the flag `name`. This is equivalent to
+// using `constraint` as a key in a struct tag, with `limit` as its value.
+// Supported constraints:
+//  min, max           - For numeric flags (including time.Duration, and
+//                       slices of either), the smallest and largest allowed
+//                       values. `limit` is parsed like a value of the flag.
+//  minlen, maxlen     - For string flags (and slices of strings), the
+//                       smallest and largest allowed length, in characters.
+//  pattern            - For string flags (and slices of strings), a regular
+//                       expression that each value must match in full.
+//  mincount, maxcount - For slice flags, the smallest and largest allowed
+//                       number of values.
+//
+// Constraints other than "mincount" are checked when a value is set, so a
+// violation is reported as an `*InvalidValueError` wrapping a
+// `*ConstraintError`. "mincount" is checked after parsing, and a violation
+// is reported as a `*ConstraintError`.
+//
+// Both "mincount" and "maxcount" count the values in the resulting slice,
+// whatever their source. That includes a default that is kept, i.e., when
+// no values are given, or under `SliceAppend` (see `SetSlicePolicy()`), but
+// not values discarded by a reset token.
+func (fs *FlagSet) SetConstraint(name, constraint, limit string) error {
+    spec, err := fs.lookup_spec(name)
+    if err != nil {
+        return err
+    }
+
+    t := spec.store_type()
+    if t == nil {
+        return fmt.Errorf("constraints are not supported for flag -%s, " +
+            "defined via Var()", name)
+    }
+    if is_slice_flag(spec) {
+        t = t.Elem()
+    } else if constraint == "mincount" || constraint == "maxcount" {
+        return fmt.Errorf("constraint %q requires a slice flag, not -%s",
+            constraint, name)
+    }
+
+    violation := func() error {
+        return &ConstraintError{Constraint: constraint, Limit: limit}
+    }
+
+    var check check_func
+    per_value := true
+    switch constraint {
+    case "min", "max":
+        if !is_numeric_kind(t.Kind()) {
+            return fmt.Errorf("constraint %q requires a numeric flag, not " +
+                "-%s", constraint, name)
+        }
+        parse := get_parse_func(t)
+        bound, err := parse(limit)
+        if err != nil {
+            return fmt.Errorf("invalid limit %q for constraint %q on flag " +
+                "-%s: %w", limit, constraint, name, err)
+        }
+        check = func(s string) (string, error) {
+            v, err := parse(s)
+            if err != nil {
+                // Let the flag report the conversion error.
+                return s, nil
+            }
+            cmp := compare_numbers(v, bound)
+            if constraint == "min" && cmp < 0 ||
+                constraint == "max" && cmp > 0 {
+                return "", violation()
+            }
+            return s, nil
+        }
+
+    case "minlen", "maxlen":
+        if t.Kind() != reflect.String {
+            return fmt.Errorf("constraint %q requires a string flag, not " +
+                "-%s", constraint, name)
+        }
+        n, err := strconv.Atoi(limit)
+        if err != nil || n < 0 {
+            return fmt.Errorf("invalid limit %q for constraint %q on flag " +
+                "-%s", limit, constraint, name)
+        }
+        check = func(s string) (string, error) {
+            length := utf8.RuneCountInString(s)
+            if constraint == "minlen" && length < n ||
+                constraint == "maxlen" && length > n {
+                return "", violation()
+            }
+            return s, nil
+        }
+
+    case "pattern":
+        if t.Kind() != reflect.String {
+            return fmt.Errorf("constraint %q requires a string flag, not " +
+                "-%s", constraint, name)
+        }
+        re, err := regexp.Compile("^(?:" + limit + ")$")
+        if err != nil {
+            return fmt.Errorf("invalid pattern for flag -%s: %w", name, err)
+        }
+        check = func(s string) (string, error) {
+            if !re.MatchString(s) {
+                return "", violation()
+            }
+            return s, nil
+        }
+
+    case "mincount", "maxcount":
+        n, err := strconv.Atoi(limit)
+        if err != nil || n < 0 {
+            return fmt.Errorf("invalid limit %q for constraint %q on flag " +
+                "-%s", limit, constraint, name)
+        }
+        if constraint == "mincount" {
+            spec.opts.min_count = n
+            break
+        }
+
+        f := fs.flag_flagset.Lookup(name)
+        per_value = false
+        check = func(s string) (string, error) {
+            // An argument that can't be split is rejected by Set.
+            parts, _ := split_values(s, spec.opts.delimiter, spec.opts.split)
+            count := len(parts) + spec.kept_count(f.Value)
+            if count > n {
+                return "", violation()
+            }
+            return s, nil
+        }
+
+    default:
+        return fmt.Errorf("unknown constraint %q for flag -%s", constraint,
+            name)
+    }
+
+    replaced := false
+    for i, c := range spec.opts.constraints {
+        if c[0] == constraint {
+            spec.opts.constraints[i][1] = limit
+            replaced = true
+        }
+    }
+    if !replaced {
+        spec.opts.constraints = append(spec.opts.constraints,
+            [2]string{constraint, limit})
+    }
+
+    if check == nil {
+        return nil
+    }
+
+    return fs.add_check(name, constraint, per_value, check)
+}
+
+func is_numeric_kind(kind reflect.Kind) bool {
+    switch kind {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+        reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+        reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32,
+        reflect.Float64:
+        return true
+    }
+
+    return false
+}
+
+// Compares two numbers of the same kind, returning -1, 0, or 1.
+func compare_numbers(a, b reflect.Value) int {
+    switch {
+    case a.CanInt():
+        x, y := a.Int(), b.Int()
+        if x != y {
+            if x < y {
+                return -1
+            }
+            return 1
+        }
+    case a.CanUint():
+        x, y := a.Uint(), b.Uint()
+        if x != y {
+            if x < y {
+                return -1
+            }
+            return 1
+        }
+    case a.CanFloat():
+        x, y := a.Float(), b.Float()
+        if x != y {
+            if x < y {
+                return -1
+            }
+            return 1
+        }
+    }
+
+    return 0
+}
@@ -0,0 +1,544 @@
+package flagutil_test
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    flagutil "github.com/cuberat/go-flagutil"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+type RequiredFlags struct {
+    Host string `flagutil:"host,required,usage='Host'"`
+    Port int `flagutil:"port,required,usage='Port'"`
+    User string `flagutil:"user,usage='User'"`
+}
+
+func TestRequired(t *testing.T) {
+    tests := []struct {
+        args []string
+        missing []string
+    }{
+        {[]string{}, []string{"host", "port", "user"}},
+        {[]string{"-host", "h"}, []string{"port", "user"}},
+        {[]string{"-port", "0", "-user", "u"}, []string{"host"}},
+        {[]string{"-host", "h", "-port", "1", "-user", "u"}, nil},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        data := new(RequiredFlags)
+        if err := flags.FlagFromStruct(data); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+        if err := flags.MarkRequired("user"); err != nil {
+            t.Fatalf("error marking flag required: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        if test.missing == nil {
+            if err != nil {
+                t.Errorf("%v: unexpected error: %s", test.args, err)
+            }
+            continue
+        }
+
+        var req_err *flagutil.RequiredFlagError
+        if !errors.As(err, &req_err) {
+            t.Errorf("%v: expected a *RequiredFlagError, got %T: %v",
+                test.args, err, err)
+            continue
+        }
+        if !reflect.DeepEqual(req_err.Flags, test.missing) {
+            t.Errorf("%v: got missing flags %v, expected %v", test.args,
+                req_err.Flags, test.missing)
+        }
+    }
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    if err := flags.MarkRequired("bogus"); err == nil {
+        t.Errorf("expected an error marking an unknown flag required")
+    }
+}
+
+func TestRequiredFromEnv(t *testing.T) {
+    t.Setenv("APP_HOST", "h")
+    t.Setenv("APP_PORT", "1")
+
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    flags.SetEnvPrefix("APP_")
+    if err := flags.FlagFromStruct(new(RequiredFlags)); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    if err := flags.Parse([]string{}); err != nil {
+        t.Errorf("unexpected error: %s", err)
+    }
+}
+
+func TestRequiredPrintDefaults(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    flags.FlagFromStruct(new(RequiredFlags))
+
+    err := flags.Parse([]string{})
+    if err == nil ||
+        err.Error() != "missing required flags: -host, -port" {
+        t.Errorf("unexpected error: %v", err)
+    }
+    for _, want := range []string{"\tHost (required)\n", "\tPort (required)\n",
+        "\tUser\n"} {
+        if !strings.Contains(buf.String(), want) {
+            t.Errorf("defaults missing %q:\n%s", want, buf.String())
+        }
+    }
+}
+
+type ChoiceFlags struct {
+    Format string `flagutil:"format,choices='json|text|yaml',usage='Format'"`
+    Level string `flagutil:"level,choices='debug|info',nocase,usage='Level'"`
+    Outputs []string `flagutil:"out,del=',',choices='a|b|c',usage='Outputs'"`
+}
+
+func TestChoices(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    data := new(ChoiceFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+    err := flags.Parse([]string{"-format", "yaml", "-level", "INFO",
+        "-out", "a,c", "-out", "b"})
+    if err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+
+    expected := ChoiceFlags{Format: "yaml", Level: "info",
+        Outputs: []string{"a", "c", "b"}}
+    if !reflect.DeepEqual(*data, expected) {
+        t.Errorf("got %+v, expected %+v", *data, expected)
+    }
+
+    for _, args := range [][]string{
+        {"-format", "JSON"},
+        {"-level", "trace"},
+        {"-out", "a,d"},
+    } {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        flags.FlagFromStruct(new(ChoiceFlags))
+
+        err := flags.Parse(args)
+        var inv_err *flagutil.InvalidValueError
+        if !errors.As(err, &inv_err) || inv_err.Flag != args[0][1:] {
+            t.Errorf("%v: expected an *InvalidValueError, got %T: %v", args,
+                err, err)
+            continue
+        }
+        if !strings.Contains(err.Error(), "must be one of") {
+            t.Errorf("%v: error doesn't list choices: %s", args, err)
+        }
+    }
+}
+
+func TestSetChoices(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    color := "auto"
+    count := 0
+    flags.Flag(&color, "color", "When to use color")
+    flags.Flag(&count, "count", "Count")
+
+    err := flags.SetChoices("color", []string{"auto", "always", "never"},
+        false)
+    if err != nil {
+        t.Fatalf("error setting choices: %s", err)
+    }
+    if err := flags.SetChoices("count", []string{"1"}, false); err == nil {
+        t.Errorf("expected an error setting choices for an int flag")
+    }
+
+    flags.PrintDefaults()
+    want := "\tWhen to use color (default \"auto\") " +
+        "(choices: auto|always|never)\n"
+    if !strings.Contains(buf.String(), want) {
+        t.Errorf("defaults missing %q:\n%s", want, buf.String())
+    }
+
+    if err := flags.Parse([]string{"-color", "sometimes"}); err == nil {
+        t.Errorf("expected an error for an invalid choice")
+    }
+    if err := flags.Parse([]string{"-color", "never"}); err != nil {
+        t.Errorf("error parsing flags: %s", err)
+    }
+    if color != "never" {
+        t.Errorf("got color %q, expected %q", color, "never")
+    }
+}
+
+type ConstraintFlags struct {
+    Port int `flagutil:"port,min=1,max=65535,usage='Port'"`
+    Ratio float64 `flagutil:"ratio,min=0,max=1,usage='Ratio'"`
+    Wait time.Duration `flagutil:"wait,max=1m,usage='Wait'"`
+    Name string `flagutil:"name,minlen=2,maxlen=4,usage='Name'"`
+    ID string `flagutil:"id,pattern='[a-z]+-[0-9]+',usage='ID'"`
+    Tags []string `flagutil:"tag,del=',',mincount=1,maxcount=3,usage='Tags'"`
+    Sizes []uint8 `flagutil:"size,del=',',min=2,usage='Sizes'"`
+}
+
+func TestConstraints(t *testing.T) {
+    tests := []struct {
+        args []string
+        flag string
+        constraint string
+    }{
+        {[]string{"-port", "0"}, "port", "min"},
+        {[]string{"-port", "65536"}, "port", "max"},
+        {[]string{"-ratio", "1.5"}, "ratio", "max"},
+        {[]string{"-wait", "2m"}, "wait", "max"},
+        {[]string{"-name", "a"}, "name", "minlen"},
+        {[]string{"-name", "abcde"}, "name", "maxlen"},
+        {[]string{"-id", "abc-1x"}, "id", "pattern"},
+        {[]string{"-tag", "a,b", "-tag", "c,d"}, "tag", "maxcount"},
+        {[]string{"-size", "3,1"}, "size", "min"},
+        {[]string{"-port", "80"}, "tag", "mincount"},
+        {[]string{"-tag", "a", "-port", "80", "-ratio", "0.5", "-wait", "1m",
+            "-name", "abcd", "-id", "abc-12", "-size", "2,3"}, "", ""},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        if err := flags.FlagFromStruct(new(ConstraintFlags)); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        if test.constraint == "" {
+            if err != nil {
+                t.Errorf("%v: unexpected error: %s", test.args, err)
+            }
+            continue
+        }
+
+        var c_err *flagutil.ConstraintError
+        if !errors.As(err, &c_err) {
+            t.Errorf("%v: expected a *ConstraintError, got %T: %v",
+                test.args, err, err)
+            continue
+        }
+        if c_err.Constraint != test.constraint {
+            t.Errorf("%v: got constraint %q, expected %q", test.args,
+                c_err.Constraint, test.constraint)
+        }
+        if !strings.Contains(err.Error(), "-" + test.flag + " ") &&
+            !strings.Contains(err.Error(), "-" + test.flag + ":") {
+            t.Errorf("%v: error doesn't name flag -%s: %s", test.args,
+                test.flag, err)
+        }
+    }
+}
+
+type CountDefaultFlags struct {
+    Tags []string `flagutil:"tag,del=',',default='a,b',mincount=2,maxcount=2,usage='Tags'"`
+}
+
+func TestCountConstraintsWithDefault(t *testing.T) {
+    tests := []struct {
+        args []string
+        constraint string
+    }{
+        // The kept default counts toward both limits.
+        {[]string{}, ""},
+        {[]string{"-tag", "c,d"}, ""},
+        // Given values replace the default.
+        {[]string{"-tag", "c"}, "mincount"},
+        {[]string{"-tag", "c,d,e"}, "maxcount"},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        if err := flags.FlagFromStruct(new(CountDefaultFlags)); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        var c_err *flagutil.ConstraintError
+        switch {
+        case test.constraint == "" && err != nil:
+            t.Errorf("%v: unexpected error: %s", test.args, err)
+        case test.constraint == "":
+        case !errors.As(err, &c_err):
+            t.Errorf("%v: expected a *ConstraintError, got %v", test.args,
+                err)
+        case c_err.Constraint != test.constraint:
+            t.Errorf("%v: got constraint %q, expected %q", test.args,
+                c_err.Constraint, test.constraint)
+        }
+    }
+}
+
+func TestConstraintDeclErrors(t *testing.T) {
+    type BadMin struct {
+        Name string `flagutil:"name,min=1"`
+    }
+    type BadLimit struct {
+        Port int `flagutil:"port,max=lots"`
+    }
+    type BadCount struct {
+        Port int `flagutil:"port,maxcount=2"`
+    }
+    type BadPattern struct {
+        ID string `flagutil:"id,pattern='[a-'"`
+    }
+
+    for _, store := range []interface{}{new(BadMin), new(BadLimit),
+        new(BadCount), new(BadPattern)} {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        if err := flags.FlagFromStruct(store); err == nil {
+            t.Errorf("%T: expected an error", store)
+        }
+    }
+
+    type BadTag struct {
+        Name string `flagutil:"name,maxlen=-1"`
+    }
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    var tag_err *flagutil.TagError
+    if err := flags.FlagFromStruct(new(BadTag)); !errors.As(err, &tag_err) {
+        t.Errorf("expected a *TagError, got %T: %v", err, err)
+    }
+
+    var level int
+    flags.Flag(&level, "level", "Level")
+    if err := flags.SetConstraint("level", "between", "1"); err == nil {
+        t.Errorf("expected an error for an unknown constraint")
+    }
+}
+
+type SourceFlags struct {
+    File string `flagutil:"file,group='source',exclusive,atleastone,usage='File'"`
+    URL string `flagutil:"url,group='source',usage='URL'"`
+    Cert string `flagutil:"cert,requires='key',usage='Cert'"`
+    Key string `flagutil:"key,usage='Key'"`
+}
+
+func TestFlagGroups(t *testing.T) {
+    tests := []struct {
+        args []string
+        expected *flagutil.FlagGroupError
+    }{
+        {[]string{"-file", "f"}, nil},
+        {[]string{"-url", "u", "-cert", "c", "-key", "k"}, nil},
+        {[]string{}, &flagutil.FlagGroupError{Relation: "atleastone",
+            Flags: []string{"file", "url"}}},
+        {[]string{"-file", "f", "-url", "u"},
+            &flagutil.FlagGroupError{Relation: "exclusive",
+                Flags: []string{"file", "url"}}},
+        {[]string{"-file", "f", "-cert", "c"},
+            &flagutil.FlagGroupError{Relation: "requires", Flag: "cert",
+                Flags: []string{"key"}}},
+    }
+
+    for _, test := range tests {
+        flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        if err := flags.FlagFromStruct(new(SourceFlags)); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+
+        err := flags.Parse(test.args)
+        if test.expected == nil {
+            if err != nil {
+                t.Errorf("%v: unexpected error: %s", test.args, err)
+            }
+            continue
+        }
+
+        var group_err *flagutil.FlagGroupError
+        if !errors.As(err, &group_err) {
+            t.Errorf("%v: expected a *FlagGroupError, got %T: %v", test.args,
+                err, err)
+            continue
+        }
+        if !reflect.DeepEqual(group_err, test.expected) {
+            t.Errorf("%v: got %+v, expected %+v", test.args, group_err,
+                test.expected)
+        }
+    }
+}
+
+func TestFlagGroupsAPI(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    var json, yaml, pretty bool
+    flags.Flag(&json, "json", "JSON output")
+    flags.Flag(&yaml, "yaml", "YAML output")
+    flags.Flag(&pretty, "pretty", "Pretty output")
+
+    if err := flags.MutuallyExclusive("json", "yaml"); err != nil {
+        t.Fatalf("error adding group: %s", err)
+    }
+    if err := flags.DependsOn("pretty", "json"); err != nil {
+        t.Fatalf("error adding dependency: %s", err)
+    }
+    if err := flags.MutuallyExclusive("json", "bogus"); err == nil {
+        t.Errorf("expected an error for an unknown flag")
+    }
+    if err := flags.DependsOn("pretty", "bogus"); err == nil {
+        t.Errorf("expected an error for an unknown flag")
+    }
+
+    err := flags.Parse([]string{"-pretty"})
+    if err == nil || err.Error() != "flag -pretty requires -json" {
+        t.Errorf("unexpected error: %v", err)
+    }
+    err = flags.Parse([]string{"-json", "-yaml"})
+    if err == nil ||
+        err.Error() != "flags -json, -yaml can't be used together" {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    for _, want := range []string{"\tJSON output (conflicts with -yaml)\n",
+        "\tPretty output (requires -json)\n"} {
+        if !strings.Contains(buf.String(), want) {
+            t.Errorf("usage missing %q:\n%s", want, buf.String())
+        }
+    }
+
+    type BadRequires struct {
+        Cert string `flagutil:"cert,requires='nokey'"`
+    }
+    flags = flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    if err := flags.FlagFromStruct(new(BadRequires)); err == nil {
+        t.Errorf("expected an error for an undefined required flag")
+    }
+}
+
+func TestAddValidator(t *testing.T) {
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(io.Discard)
+    port := 8080
+    hosts := []string{}
+    flags.Flag(&port, "port", "Port")
+    flags.FlagSep(&hosts, "host", "Hosts", ",")
+
+    var got []interface{}
+    err := flags.AddValidator("port", func(value interface{}) error {
+        got = append(got, value)
+        if value.(int) % 2 != 0 {
+            return errors.New("must be even")
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("error adding validator: %s", err)
+    }
+    flags.AddValidator("host", func(value interface{}) error {
+        got = append(got, value)
+        return nil
+    })
+    if err := flags.AddValidator("bogus", nil); err == nil {
+        t.Errorf("expected an error for an unknown flag")
+    }
+
+    if err := flags.Parse([]string{"-host", "a,b"}); err != nil {
+        t.Fatalf("error parsing flags: %s", err)
+    }
+    // Validators are only called for flags that were set.
+    expected := []interface{}{[]string{"a", "b"}}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got validator values %v, expected %v", got, expected)
+    }
+
+    err = flags.Parse([]string{"-port", "81"})
+    var inv_err *flagutil.InvalidValueError
+    if !errors.As(err, &inv_err) || inv_err.Flag != "port" ||
+        inv_err.Value != "81" {
+        t.Errorf("expected an *InvalidValueError for -port, got %T: %v", err,
+            err)
+    }
+}
+
+type RangeFlags struct {
+    Low int `flagutil:"low,usage='Low'"`
+    High int `flagutil:"high,usage='High'"`
+}
+
+func (r *RangeFlags) Validate() error {
+    if r.Low > r.High {
+        return fmt.Errorf("-low (%d) must not be greater than -high (%d)",
+            r.Low, r.High)
+    }
+    return nil
+}
+
+func TestStructValidate(t *testing.T) {
+    buf := new(bytes.Buffer)
+    flags := flagutil.NewFlagSet("test", flagutil.ContinueOnError)
+    flags.SetOutput(buf)
+    data := new(RangeFlags)
+    if err := flags.FlagFromStruct(data); err != nil {
+        t.Fatalf("error adding flags: %s", err)
+    }
+
+    if err := flags.Parse([]string{"-low", "1", "-high", "2"}); err != nil {
+        t.Errorf("unexpected error: %s", err)
+    }
+
+    err := flags.Parse([]string{"-low", "3"})
+    var parse_err *flagutil.ParseError
+    if !errors.As(err, &parse_err) {
+        t.Fatalf("expected a *ParseError, got %T: %v", err, err)
+    }
+    want := "-low (3) must not be greater than -high (2)"
+    if err.Error() != want {
+        t.Errorf("got error %q, expected %q", err, want)
+    }
+    if !strings.HasPrefix(buf.String(), want + "\n") {
+        t.Errorf("error not reported:\n%s", buf.String())
+    }
+}
+
+type ValidatedCLIFlags struct {
+    DryRun bool `flagutil:"dry-run,usage='Dry run'"`
+    Serve *ServeFlags `flagutil:"serve,cmd,usage='Run the server'"`
+}
+
+func (c *ValidatedCLIFlags) Validate() error {
+    if c.DryRun && c.Serve != nil && c.Serve.Port != 0 {
+        return errors.New("-dry-run can't be used with serve -port")
+    }
+    return nil
+}
+
+func TestStructValidateSubcommand(t *testing.T) {
+    new_flags := func(data *ValidatedCLIFlags) *flagutil.FlagSet {
+        flags := flagutil.NewFlagSet("tool", flagutil.ContinueOnError)
+        flags.SetOutput(io.Discard)
+        if err := flags.FlagFromStruct(data); err != nil {
+            t.Fatalf("error adding flags: %s", err)
+        }
+        return flags
+    }
+
+    data := new(ValidatedCLIFlags)
+    err := new_flags(data).Parse([]string{"-dry-run", "serve"})
+    if err != nil {
+        t.Errorf("unexpected error: %s", err)
+    }
+
+    data = new(ValidatedCLIFlags)
+    err = new_flags(data).Parse([]string{"-dry-run", "serve", "-port", "80"})
+    if err == nil {
+        t.Errorf("expected an error from Validate()")
+    }
+}
@@ -27,76 +27,201 @@
 package flagutil
 
 import (
-    // "flag"
+    "encoding"
+    "flag"
     "fmt"
+    "reflect"
     "strconv"
     "strings"
+    "time"
 )
 
-// Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
-// passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgInt struct {
-    Args []int
+// Implements the `flag.Value` and `flag.Getter` interfaces for a slice of
+// any type. Useful for passing to `flag.Var()` or `flagutil.Var()`. Used by
+// `flagutil.Flag()` to implement flags as slices.
+//
+// Each value is converted using `Parse`. If `Parse` is nil, values are
+// parsed based on the type `T`, in the same way as for `flagutil.Flag()`.
+// `Split` controls how an argument is split on `Del`, e.g., to allow quoted
+// values that contain the delimiter.
+type MultiArg[T any] struct {
+    Args []T
     Del string
+    Parse func(s string) (T, error)
+    Split SplitOptions
+}
+
+// Slices of the types supported by the flag module. These were originally
+// separate types, and are kept for compatibility. Each has the methods of
+// the corresponding `MultiArg[T]`, along with its original getter.
+type (
+    MultiArgInt MultiArg[int]
+    MultiArgInt64 MultiArg[int64]
+    MultiArgUint MultiArg[uint]
+    MultiArgUint64 MultiArg[uint64]
+    MultiArgFloat64 MultiArg[float64]
+    MultiArgString MultiArg[string]
+)
+
+// A slice of `time.Duration`, parsed using `time.ParseDuration()`.
+type MultiArgDuration = MultiArg[time.Duration]
+
+// Returns a new object initialized with the specified delimiter and parse
+// function. If a delimiter is specified, it is used to split individual
+// command line arguments into multiple values. If `parse` is nil, values are
+// parsed based on the type `T`.
+func NewMultiArg[T any](
+    delimiter string,
+    parse func(s string) (T, error),
+) *MultiArg[T] {
+    return &MultiArg[T]{Del: delimiter, Parse: parse}
 }
 
 // Returns a new object initialized with the specified delimiter. If a
 // delimiter is specified, it is used to split individual command line
 // arguments into multiple values.
 func NewMultiArgInt(delimiter string) (*MultiArgInt) {
-    return &MultiArgInt{Del: delimiter}
+    return (*MultiArgInt)(
+        NewMultiArg(delimiter, func(s string) (int, error) {
+            v, err := strconv.ParseInt(s, 10, strconv.IntSize)
+            return int(v), err
+        }),
+    )
 }
 
-// Returns the resulting []int as an interface{}.
-func (ma *MultiArgInt) Get() (interface{}) {
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values.
+func NewMultiArgInt64(delimiter string) (*MultiArgInt64) {
+    return (*MultiArgInt64)(
+        NewMultiArg(delimiter, func(s string) (int64, error) {
+            return strconv.ParseInt(s, 10, 64)
+        }),
+    )
+}
+
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values.
+func NewMultiArgUint(delimiter string) (*MultiArgUint) {
+    return (*MultiArgUint)(
+        NewMultiArg(delimiter, func(s string) (uint, error) {
+            v, err := strconv.ParseUint(s, 10, strconv.IntSize)
+            return uint(v), err
+        }),
+    )
+}
+
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values.
+func NewMultiArgUint64(delimiter string) (*MultiArgUint64) {
+    return (*MultiArgUint64)(
+        NewMultiArg(delimiter, func(s string) (uint64, error) {
+            return strconv.ParseUint(s, 10, 64)
+        }),
+    )
+}
+
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values.
+func NewMultiArgFloat64(delimiter string) (*MultiArgFloat64) {
+    return (*MultiArgFloat64)(
+        NewMultiArg(delimiter, func(s string) (float64, error) {
+            return strconv.ParseFloat(s, 64)
+        }),
+    )
+}
+
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values.
+func NewMultiArgString(delimiter string) (*MultiArgString) {
+    return (*MultiArgString)(
+        NewMultiArg(delimiter, func(s string) (string, error) {
+            return s, nil
+        }),
+    )
+}
+
+// Returns a new object initialized with the specified delimiter. If a
+// delimiter is specified, it is used to split individual command line
+// arguments into multiple values. Values are parsed using
+// `time.ParseDuration()`.
+func NewMultiArgDuration(delimiter string) (*MultiArgDuration) {
+    return NewMultiArg(delimiter, time.ParseDuration)
+}
+
+// Returns the resulting []T as an interface{}.
+func (ma *MultiArg[T]) Get() (interface{}) {
     return ma.Args
 }
 
-// Returns the resulting []int.
-func (ma *MultiArgInt) GetInts() ([]int) {
+// Returns the resulting []T.
+func (ma *MultiArg[T]) Values() ([]T) {
     return ma.Args
 }
 
-// Returns the resulting []int as a string formatted with "+v".
-func (ma *MultiArgInt) String() string {
+// Returns the resulting []T as a string formatted with "%+v".
+func (ma *MultiArg[T]) String() string {
+    if ma == nil {
+        return "[]"
+    }
     return fmt.Sprintf("%+v", ma.Args)
 }
 
-// Parses and appends `val` to the underlying []int, after splitting on the
-// specified delimiter (if not "").
-func (ma *MultiArgInt) Set(val string) error {
-    var args []string
-    if ma.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, ma.Del)
+// Parses and appends `val` to the underlying []T, after splitting on the
+// specified delimiter (if not "") according to `Split`. If any of the values
+// fail to parse, none of them are appended.
+func (ma *MultiArg[T]) Set(val string) error {
+    args, err := split_values(val, ma.Del, ma.Split)
+    if err != nil {
+        return err
     }
 
+    parse := ma.Parse
+    if parse == nil {
+        parse = type_parser[T]()
+    }
+
+    vals := make([]T, 0, len(args))
     for _, str_val := range args {
-        int_val, err := strconv.ParseInt(str_val, 10, 64)
+        v, err := parse(str_val)
         if err != nil {
             return err
         }
-        ma.Args = append(ma.Args, int(int_val))
+        vals = append(vals, v)
     }
+    ma.Args = append(ma.Args, vals...)
 
     return nil
 }
 
-// Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
-// passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgInt64 struct {
-    Args []int64
-    Del string
+// Returns the resulting []int as an interface{}.
+func (ma *MultiArgInt) Get() (interface{}) {
+    return ma.Args
 }
 
-// Returns a new object initialized with the specified delimiter. If a
-// delimiter is specified, it is used to split individual command line
-// arguments into multiple values.
-func NewMultiArgInt64(delimiter string) (*MultiArgInt64) {
-    return &MultiArgInt64{Del: delimiter}
+// Returns the resulting []int.
+func (ma *MultiArgInt) GetInts() ([]int) {
+    return ma.Args
+}
+
+// Returns the resulting []int.
+func (ma *MultiArgInt) Values() ([]int) {
+    return ma.Args
+}
+
+// Returns the resulting []int as a string formatted with "%+v".
+func (ma *MultiArgInt) String() string {
+    return (*MultiArg[int])(ma).String()
+}
+
+// Parses and appends `val` to the underlying []int, as for
+// `MultiArg[int].Set()`.
+func (ma *MultiArgInt) Set(val string) error {
+    return (*MultiArg[int])(ma).Set(val)
 }
 
 // Returns the resulting []int64 as an interface{}.
@@ -109,90 +234,72 @@ func (ma *MultiArgInt64) GetInt64s() ([]int64) {
     return ma.Args
 }
 
-// Returns the resulting []int64 as a string formatted with "+v".
+// Returns the resulting []int64.
+func (ma *MultiArgInt64) Values() ([]int64) {
+    return ma.Args
+}
+
+// Returns the resulting []int64 as a string formatted with "%+v".
 func (ma *MultiArgInt64) String() string {
-    return fmt.Sprintf("%+v", ma.Args)
+    return (*MultiArg[int64])(ma).String()
 }
 
-// Parses and appends `val` to the underlying []int64, after splitting on the
-// specified delimiter (if not "").
+// Parses and appends `val` to the underlying []int64, as for
+// `MultiArg[int64].Set()`.
 func (ma *MultiArgInt64) Set(val string) error {
-    var args []string
-    if ma.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, ma.Del)
-    }
-
-    for _, str_val := range args {
-        int_val, err := strconv.ParseInt(str_val, 10, 64)
-        if err != nil {
-            return err
-        }
-        ma.Args = append(ma.Args, int_val)
-    }
+    return (*MultiArg[int64])(ma).Set(val)
+}
 
-    return nil
+// Returns the resulting []uint as an interface{}.
+func (ma *MultiArgUint) Get() (interface{}) {
+    return ma.Args
 }
 
-// Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
-// passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgString struct {
-    Args []string
-    Del string
+// Returns the resulting []uint.
+func (ma *MultiArgUint) GetUints() ([]uint) {
+    return ma.Args
 }
 
-// Returns a new object initialized with the specified delimiter. If a
-// delimiter is specified, it is used to split individual command line
-// arguments into multiple values.
-func NewMultiArgString(delimiter string) (*MultiArgString) {
-    return &MultiArgString{Del: delimiter}
+// Returns the resulting []uint.
+func (ma *MultiArgUint) Values() ([]uint) {
+    return ma.Args
 }
 
-// Returns the resulting []string as an interface{}.
-func (mas *MultiArgString) Get() (interface{}) {
-    return mas.Args
+// Returns the resulting []uint as a string formatted with "%+v".
+func (ma *MultiArgUint) String() string {
+    return (*MultiArg[uint])(ma).String()
 }
 
-// Returns the resulting []string.
-func (mas *MultiArgString) GetStrings() ([]string) {
-    return mas.Args
+// Parses and appends `val` to the underlying []uint, as for
+// `MultiArg[uint].Set()`.
+func (ma *MultiArgUint) Set(val string) error {
+    return (*MultiArg[uint])(ma).Set(val)
 }
 
-// Returns the resulting []string as a string formatted with "%+v".
-func (mas *MultiArgString) String() string {
-    return fmt.Sprintf("%+v", mas.Args)
-}
-
-// Appends `val` to the underlying []string, after splitting on the specified
-// delimiter (if not "").
-func (mas *MultiArgString) Set(val string) error {
-    var args []string
-    if mas.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, mas.Del)
-    }
+// Returns the resulting []uint64 as an interface{}.
+func (ma *MultiArgUint64) Get() (interface{}) {
+    return ma.Args
+}
 
-    mas.Args = append(mas.Args, args...)
+// Returns the resulting []uint64.
+func (ma *MultiArgUint64) GetUint64s() ([]uint64) {
+    return ma.Args
+}
 
-    return nil
+// Returns the resulting []uint64.
+func (ma *MultiArgUint64) Values() ([]uint64) {
+    return ma.Args
 }
 
-// Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
-// passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgFloat64 struct {
-    Args []float64
-    Del string
+// Returns the resulting []uint64 as a string formatted with "%+v".
+func (ma *MultiArgUint64) String() string {
+    return (*MultiArg[uint64])(ma).String()
 }
 
-// Returns a new object initialized with the specified delimiter. If a
-// delimiter is specified, it is used to split individual command line
-// arguments into multiple values.
-func NewMultiArgFloat64(delimiter string) (*MultiArgFloat64) {
-    return &MultiArgFloat64{Del: delimiter}
+// Parses and appends `val` to the underlying []uint64, as for
+// `MultiArg[uint64].Set()`.
+func (ma *MultiArgUint64) Set(val string) error {
+    return (*MultiArg[uint64])(ma).Set(val)
 }
 
 // Returns the resulting []float64 as an interface{}.
@@ -205,130 +312,398 @@ func (ma *MultiArgFloat64) GetFloat64s() ([]float64) {
     return ma.Args
 }
 
-// Returns the resulting []float64 as a string formatted with "+v".
+// Returns the resulting []float64.
+func (ma *MultiArgFloat64) Values() ([]float64) {
+    return ma.Args
+}
+
+// Returns the resulting []float64 as a string formatted with "%+v".
 func (ma *MultiArgFloat64) String() string {
-    return fmt.Sprintf("%+v", ma.Args)
+    return (*MultiArg[float64])(ma).String()
 }
 
-// Appends `val` to the underlying []float64, after splitting on the specified
-// delimiter (if not "").
+// Parses and appends `val` to the underlying []float64, as for
+// `MultiArg[float64].Set()`.
 func (ma *MultiArgFloat64) Set(val string) error {
-    var args []string
-    if ma.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, ma.Del)
-    }
+    return (*MultiArg[float64])(ma).Set(val)
+}
 
-    for _, str_val := range args {
-        float_val, err := strconv.ParseFloat(str_val, 64)
+// Returns the resulting []string as an interface{}.
+func (ma *MultiArgString) Get() (interface{}) {
+    return ma.Args
+}
+
+// Returns the resulting []string.
+func (ma *MultiArgString) GetStrings() ([]string) {
+    return ma.Args
+}
+
+// Returns the resulting []string.
+func (ma *MultiArgString) Values() ([]string) {
+    return ma.Args
+}
+
+// Returns the resulting []string as a string formatted with "%+v".
+func (ma *MultiArgString) String() string {
+    return (*MultiArg[string])(ma).String()
+}
+
+// Parses and appends `val` to the underlying []string, as for
+// `MultiArg[string].Set()`.
+func (ma *MultiArgString) Set(val string) error {
+    return (*MultiArg[string])(ma).Set(val)
+}
+
+// Returns a function that parses values of type `T` using the parse_func for
+// elements of slices of the type.
+func type_parser[T any]() func(s string) (T, error) {
+    t := reflect.TypeOf((*T)(nil)).Elem()
+    parse := slice_parse_func(t)
+
+    return func(s string) (T, error) {
+        var zero T
+        if parse == nil {
+            return zero, fmt.Errorf("unsupported type %v", t)
+        }
+        v, err := parse(s)
         if err != nil {
-            return err
+            return zero, err
         }
-        ma.Args = append(ma.Args, float_val)
+        return v.Interface().(T), nil
     }
-
-    return nil
 }
 
-// Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
-// passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgUint64 struct {
-    Args []uint64
-    Del string
+// Like `MultiArg[time.Time]`, but formats the times using `Layout` when
+// converted to a string.
+type MultiArgTime struct {
+    MultiArg[time.Time]
+    Layout string
 }
 
-// Returns a new object initialized with the specified delimiter. If a
-// delimiter is specified, it is used to split individual command line
-// arguments into multiple values.
-func NewMultiArgUint64(delimiter string) (*MultiArgUint64) {
-    return &MultiArgUint64{Del: delimiter}
+// Returns a new object initialized with the specified delimiter and layout.
+// If a delimiter is specified, it is used to split individual command line
+// arguments into multiple values. The layout is passed to `time.Parse()`. If
+// it is empty, `time.RFC3339` is used.
+func NewMultiArgTime(delimiter, layout string) (*MultiArgTime) {
+    return &MultiArgTime{
+        MultiArg: MultiArg[time.Time]{Del: delimiter},
+        Layout: layout,
+    }
 }
 
-// Returns the resulting []uint64 as an interface{}.
-func (ma *MultiArgUint64) Get() (interface{}) {
+// Returns the resulting []time.Time.
+func (ma *MultiArgTime) GetTimes() ([]time.Time) {
     return ma.Args
 }
 
-// Returns the resulting []uint64.
-func (ma *MultiArgUint64) GetUint64s() ([]uint64) {
-    return ma.Args
+// Returns the resulting []time.Time as a string, with each time formatted
+// using the layout.
+func (ma *MultiArgTime) String() string {
+    if ma == nil {
+        return "[]"
+    }
+    strs := make([]string, 0, len(ma.Args))
+    for _, t := range ma.Args {
+        strs = append(strs, t.Format(time_layout(ma.Layout)))
+    }
+    return fmt.Sprintf("%+v", strs)
 }
 
-// Returns the resulting []uint64 as a string formatted with "+v".
-func (ma *MultiArgUint64) String() string {
-    return fmt.Sprintf("%+v", ma.Args)
+// Parses (using `time.Parse()` with the layout) and appends `val` to the
+// underlying []time.Time, after splitting on the specified delimiter (if not
+// "").
+func (ma *MultiArgTime) Set(val string) error {
+    if ma.Parse == nil {
+        ma.Parse = func(s string) (time.Time, error) {
+            return time.Parse(time_layout(ma.Layout), s)
+        }
+    }
+
+    return ma.MultiArg.Set(val)
 }
 
-// Appends `val` to the underlying []uint64, after splitting on the specified
-// delimiter (if not "").
-func (ma *MultiArgUint64) Set(val string) error {
-    var args []string
-    if ma.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, ma.Del)
+// Implements `flag.Value` and `flag.Getter` for a single `time.Time`.
+type time_value struct {
+    ptr *time.Time
+    layout string
+}
+
+func new_time_value(ptr *time.Time, layout string) *time_value {
+    return &time_value{ptr: ptr, layout: layout}
+}
+
+func (tv *time_value) Get() interface{} {
+    return *tv.ptr
+}
+
+func (tv *time_value) String() string {
+    if tv.ptr == nil || tv.ptr.IsZero() {
+        return ""
     }
+    return tv.ptr.Format(time_layout(tv.layout))
+}
 
-    for _, str_val := range args {
-        int_val, err := strconv.ParseUint(str_val, 10, 64)
-        if err != nil {
-            return err
+func (tv *time_value) Set(val string) error {
+    t, err := time.Parse(time_layout(tv.layout), val)
+    if err != nil {
+        return err
+    }
+    *tv.ptr = t
+
+    return nil
+}
+
+// Returns the layout to use for parsing times, defaulting to RFC 3339.
+func time_layout(layout string) string {
+    if layout == "" {
+        return time.RFC3339
+    }
+    return layout
+}
+
+// Wraps the flag.Value from the flag module for a numeric type, checking
+// arguments with `parse` first, so that a bad argument is reported with the
+// error from `parse` (e.g., a `*strconv.NumError`) rather than the flag
+// module's own.
+type numeric_value struct {
+    flag.Value
+    parse parse_func
+}
+
+func (nv *numeric_value) Set(val string) error {
+    if _, err := nv.parse(val); err != nil {
+        return err
+    }
+
+    return nv.Value.Set(val)
+}
+
+func (nv *numeric_value) Get() interface{} {
+    return nv.Value.(flag.Getter).Get()
+}
+
+// Implements `flag.Value` and `flag.Getter` for a single value of any type
+// supported by a parse_func, e.g., a named numeric type.
+type reflect_value struct {
+    ptr reflect.Value
+    parse parse_func
+}
+
+func new_reflect_value(ptr reflect.Value, parse parse_func) *reflect_value {
+    return &reflect_value{ptr: ptr, parse: parse}
+}
+
+func (rv *reflect_value) Get() interface{} {
+    return rv.ptr.Elem().Interface()
+}
+
+// Returns the value formatted using its `MarshalText()` method, if it has
+// one, or with "%v" otherwise. Returns "" for the zero value.
+func (rv *reflect_value) String() string {
+    if !rv.ptr.IsValid() || rv.ptr.Elem().IsZero() {
+        return ""
+    }
+    if m, ok := rv.ptr.Interface().(encoding.TextMarshaler); ok {
+        if text, err := m.MarshalText(); err == nil {
+            return string(text)
         }
-        ma.Args = append(ma.Args, int_val)
     }
+    return fmt.Sprintf("%v", rv.ptr.Elem().Interface())
+}
+
+func (rv *reflect_value) Set(val string) error {
+    v, err := rv.parse(val)
+    if err != nil {
+        return err
+    }
+    rv.ptr.Elem().Set(v)
 
     return nil
 }
 
+// Bool kinds don't require an argument on the command line.
+func (rv *reflect_value) IsBoolFlag() bool {
+    return rv.ptr.IsValid() && rv.ptr.Elem().Kind() == reflect.Bool
+}
+
 // Implements the `flag.Value` and `flag.Getter` interfaces. Useful for
 // passing to `flag.Var()` or `flagutil.Var()`. Used by `flagutil.Flag()` to
-// implement flags as slices.
-type MultiArgUint struct {
-    Args []uint
-    Del string
+// implement flags as maps, e.g., "-label env=prod -label team=core".
+type MultiArgMap struct {
+    Args map[string]string
+    Del string          // Splits an argument into multiple key/value pairs.
+    Sep string          // Separates the key from the value. "=" if empty.
+    ErrorOnDup bool     // Return an error for a repeated key (else last wins).
+    Split SplitOptions  // How an argument is split on `Del`.
 }
 
-// Returns a new object initialized with the specified delimiter. If a
-// delimiter is specified, it is used to split individual command line
-// arguments into multiple values.
-func NewMultiArgUint(delimiter string) (*MultiArgUint) {
-    return &MultiArgUint{Del: delimiter}
+// Returns a new object initialized with the specified delimiter and
+// key/value separator. If a delimiter is specified, it is used to split
+// individual command line arguments into multiple key/value pairs. If the
+// separator is empty, "=" is used.
+func NewMultiArgMap(delimiter, separator string) (*MultiArgMap) {
+    return &MultiArgMap{Del: delimiter, Sep: separator}
 }
 
-// Returns the resulting []uint as an interface{}.
-func (ma *MultiArgUint) Get() (interface{}) {
+// Returns the resulting map[string]string as an interface{}.
+func (ma *MultiArgMap) Get() (interface{}) {
     return ma.Args
 }
 
-// Returns the resulting []uint.
-func (ma *MultiArgUint) GetUints() ([]uint) {
+// Returns the resulting map[string]string.
+func (ma *MultiArgMap) GetMap() (map[string]string) {
     return ma.Args
 }
 
-// Returns the resulting []uint as a string formatted with "+v".
-func (ma *MultiArgUint) String() string {
+// Returns the resulting map[string]string as a string formatted with "+v".
+func (ma *MultiArgMap) String() string {
     return fmt.Sprintf("%+v", ma.Args)
 }
 
-// Appends `val` to the underlying []uint, after splitting on the specified
-// delimiter (if not "").
-func (ma *MultiArgUint) Set(val string) error {
-    var args []string
-    if ma.Del == "" {
-        args = []string{val}
-    } else {
-        args = strings.Split(val, ma.Del)
+// Splits `val` into key/value pairs and adds them to the underlying
+// map[string]string.
+func (ma *MultiArgMap) Set(val string) error {
+    pairs, err := split_pairs(val, ma.Del, ma.Sep, ma.Split)
+    if err != nil {
+        return err
     }
 
-    for _, str_val := range args {
-        int_val, err := strconv.ParseUint(str_val, 10, 64)
+    if ma.Args == nil {
+        ma.Args = make(map[string]string, len(pairs))
+    }
+
+    for _, pair := range pairs {
+        if _, ok := ma.Args[pair[0]]; ok && ma.ErrorOnDup {
+            return fmt.Errorf("duplicate key %q", pair[0])
+        }
+        ma.Args[pair[0]] = pair[1]
+    }
+
+    return nil
+}
+
+// Splits `val` on `del` (if not "") according to `opts` into key/value
+// pairs separated by `sep` ("=" if empty).
+func split_pairs(
+    val, del, sep string,
+    opts SplitOptions,
+) ([][2]string, error) {
+    if sep == "" {
+        sep = "="
+    }
+
+    args, err := split_values(val, del, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    pairs := make([][2]string, 0, len(args))
+    for _, arg := range args {
+        idx := strings.Index(arg, sep)
+        if idx < 0 {
+            return nil, fmt.Errorf("missing %q in key/value pair %q", sep,
+                arg)
+        }
+        pairs = append(pairs, [2]string{arg[:idx], arg[idx + len(sep):]})
+    }
+
+    return pairs, nil
+}
+
+// Like `MultiArgMap`, but for maps with keys and values of any type
+// supported by a parse_func. Used by `flagutil.Flag()` for map types other
+// than map[string]string.
+type map_arg_value struct {
+    values reflect.Value
+    del string
+    sep string
+    parse_key parse_func
+    parse_val parse_func
+    error_on_dup bool
+    split SplitOptions
+}
+
+func new_map_arg_value(
+    map_type reflect.Type,
+    delimiter, separator string,
+    parse_key, parse_val parse_func,
+) *map_arg_value {
+    return &map_arg_value{
+        values: reflect.MakeMap(map_type),
+        del: delimiter,
+        sep: separator,
+        parse_key: parse_key,
+        parse_val: parse_val,
+    }
+}
+
+func (ma *map_arg_value) Get() interface{} {
+    return ma.values.Interface()
+}
+
+func (ma *map_arg_value) String() string {
+    if !ma.values.IsValid() {
+        return "map[]"
+    }
+    return fmt.Sprintf("%+v", ma.values.Interface())
+}
+
+func (ma *map_arg_value) Set(val string) error {
+    pairs, err := split_pairs(val, ma.del, ma.sep, ma.split)
+    if err != nil {
+        return err
+    }
+
+    for _, pair := range pairs {
+        key, err := ma.parse_key(pair[0])
         if err != nil {
-            return err
+            return fmt.Errorf("invalid key %q: %w", pair[0], err)
         }
-        ma.Args = append(ma.Args, uint(int_val))
+        value, err := ma.parse_val(pair[1])
+        if err != nil {
+            return fmt.Errorf("invalid value for key %q: %w", pair[0], err)
+        }
+
+        if ma.error_on_dup && ma.values.MapIndex(key).IsValid() {
+            return fmt.Errorf("duplicate key %q", pair[0])
+        }
+        ma.values.SetMapIndex(key, value)
     }
 
     return nil
 }
+
+// How the values given for a slice flag are combined with the value the
+// bound slice starts with (its default). See `FlagSet.SetSlicePolicy()`.
+type SlicePolicy int
+
+const (
+    // The values given replace the default. This is the default policy.
+    SliceReplace SlicePolicy = iota
+
+    // The values given are appended to the default.
+    SliceAppend
+)
+
+// Wraps the flag.Value for a slice flag to handle the reset token: an empty
+// argument discards the default and any values given before it.
+type slice_value struct {
+    flag.Value
+    count func() int // Number of values collected by the flag.Value.
+    reset bool
+    start int // Index of the first value given after the last reset.
+}
+
+func (sv *slice_value) Set(val string) error {
+    if val == "" {
+        sv.reset = true
+        sv.start = sv.count()
+        return nil
+    }
+
+    return sv.Value.Set(val)
+}
+
+func (sv *slice_value) Get() interface{} {
+    return sv.Value.(flag.Getter).Get()
+}